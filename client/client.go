@@ -0,0 +1,478 @@
+// Package client is an SMPP 3.4 ESME client.
+//
+// It binds to an SMSC, submits short messages (segmented when needed) with a window of unacknowledged requests,
+// receives the messages and DLRs sent by the SMSC, keeps the session alive with enquire_link
+// and reconnects when the connection is lost.
+package client
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mdouchement/logger"
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Bind types.
+const (
+	Transceiver BindType = iota // Submits and receives messages
+	Transmitter                 // Submits messages
+	Receiver                    // Receives messages
+)
+
+var (
+	// ErrNotBound is returned when the client is not bound to the SMSC.
+	ErrNotBound = errors.New("client: not bound")
+	// ErrClosed is returned when the client is closed.
+	ErrClosed = errors.New("client: closed")
+	// ErrTimeout is returned when the SMSC does not answer a request in time.
+	ErrTimeout = errors.New("client: response timeout")
+)
+
+type (
+	// A BindType is the type of bind sent to the SMSC.
+	BindType int
+
+	// A Config configures a Client.
+	Config struct {
+		Addr         string // SMPP address of the SMSC, host:port
+		SystemID     string
+		Password     string
+		SystemType   string
+		AddressRange string
+		BindType     BindType
+
+		// Account tells how the texts are coded (GSM 7-bit packing, default alphabet), the SMSC defaults when nil.
+		Account *smpp.Account
+
+		Window      int           // Maximum number of unacknowledged submit_sm, 10 by default
+		Timeout     time.Duration // Response timeout of the requests, 10s by default
+		EnquireLink time.Duration // Interval of the enquire_link, 30s by default, disabled when negative
+		Reconnect   time.Duration // Delay between reconnections, 5s by default, disabled when negative
+
+		// OnMessage is called with each message (MO) sent by the SMSC.
+		// It returns the command_status of the deliver_sm_resp.
+		OnMessage func(Message) pdu.Status
+		// OnReceipt is called with each DLR sent by the SMSC.
+		// It returns the command_status of the deliver_sm_resp.
+		OnReceipt func(Receipt) pdu.Status
+
+		Logger logger.Logger // Discarded when nil
+	}
+
+	// A Client is an ESME bound to an SMSC.
+	Client struct {
+		config   Config
+		log      logger.Logger
+		window   chan struct{}
+		sequence uint32
+
+		mu      sync.Mutex
+		conn    *smpp.Connection
+		bound   chan struct{} // Closed when bound
+		closed  chan struct{}
+		pending map[uint32]*request
+	}
+
+	// A Message is a message sent by the SMSC.
+	Message struct {
+		Src  string
+		Dst  string
+		Text string
+		PDU  pdu.Body
+	}
+
+	request struct {
+		timer *time.Timer
+		done  func(pdu.Body, error)
+	}
+)
+
+func (t BindType) String() string {
+	switch t {
+	case Transmitter:
+		return "transmitter"
+	case Receiver:
+		return "receiver"
+	}
+	return "transceiver"
+}
+
+// Dial connects and binds to the SMSC.
+// The client then reconnects in background when the connection is lost, until it is closed.
+func Dial(config Config) (*Client, error) {
+	if config.Window <= 0 {
+		config.Window = 10
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.EnquireLink == 0 {
+		config.EnquireLink = 30 * time.Second
+	}
+	if config.Reconnect == 0 {
+		config.Reconnect = 5 * time.Second
+	}
+	if config.Logger == nil {
+		l := logrus.New()
+		l.SetOutput(io.Discard)
+		config.Logger = logger.WrapLogrus(l)
+	}
+
+	c := &Client{
+		config:  config,
+		log:     config.Logger,
+		window:  make(chan struct{}, config.Window),
+		bound:   make(chan struct{}),
+		closed:  make(chan struct{}),
+		pending: map[uint32]*request{},
+	}
+
+	conn, err := c.bind()
+	if err != nil {
+		return nil, err
+	}
+
+	go c.run(conn)
+	if c.config.EnquireLink > 0 {
+		go c.keepalive()
+	}
+	return c, nil
+}
+
+// Close unbinds the client and closes the connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		return ErrClosed
+	default:
+		close(c.closed)
+	}
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	// The unbind_resp is awaited but the connection is closed anyway.
+	_, err := c.request(conn, pdu.NewUnbind())
+	if cerr := conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Bound returns true if the client is currently bound to the SMSC.
+func (c *Client) Bound() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conn != nil
+}
+
+func (c *Client) bind() (*smpp.Connection, error) {
+	nc, err := net.DialTimeout("tcp", c.config.Addr, c.config.Timeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "client: dial")
+	}
+	conn := smpp.NewConnection(c.log, nc)
+	conn.Alphabet = c.config.Account.Alphabet()
+
+	var p pdu.Body
+	switch c.config.BindType {
+	case Transmitter:
+		p = pdu.NewBindTransmitter()
+	case Receiver:
+		p = pdu.NewBindReceiver()
+	default:
+		p = pdu.NewBindTransceiver()
+	}
+	f := p.Fields()
+	f.Set(pdufield.SystemID, c.config.SystemID)
+	f.Set(pdufield.Password, c.config.Password)
+	f.Set(pdufield.SystemType, c.config.SystemType)
+	f.Set(pdufield.InterfaceVersion, 0x34)
+	f.Set(pdufield.AddressRange, c.config.AddressRange)
+	p.Header().Seq = atomic.AddUint32(&c.sequence, 1)
+
+	// The bind_resp is read before handing the connection to the read loop.
+	conn.SetDeadline(time.Now().Add(c.config.Timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err = conn.Serialize(p); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "client: bind")
+	}
+	r, err := conn.Decode()
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "client: bind")
+	}
+	if r.Header().Status != 0 {
+		conn.Close()
+		return nil, errors.Wrapf(r.Header().Status, "client: bind %s", c.config.BindType)
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	close(c.bound)
+	c.mu.Unlock()
+
+	c.log.Infof("Bound as %s %s to %s", c.config.BindType, c.config.SystemID, c.config.Addr)
+	return conn, nil
+}
+
+// run reads the connection and reconnects when it is lost.
+func (c *Client) run(conn *smpp.Connection) {
+	for {
+		err := c.read(conn)
+		c.disconnect(conn, err)
+
+		for {
+			if c.config.Reconnect < 0 {
+				c.mu.Lock()
+				if !c.isClosed() {
+					close(c.closed)
+				}
+				c.mu.Unlock()
+				return
+			}
+
+			select {
+			case <-c.closed:
+				return
+			case <-time.After(c.config.Reconnect):
+			}
+
+			if conn, err = c.bind(); err == nil {
+				break
+			}
+			c.log.WithError(err).Warn("Could not reconnect")
+		}
+	}
+}
+
+// disconnect fails the pending requests of the lost connection.
+func (c *Client) disconnect(conn *smpp.Connection, err error) {
+	conn.Close()
+
+	c.mu.Lock()
+	c.conn = nil
+	c.bound = make(chan struct{})
+	pending := c.pending
+	c.pending = map[uint32]*request{}
+	closed := c.isClosed()
+	c.mu.Unlock()
+
+	if !closed {
+		c.log.WithError(err).Warn("Connection lost")
+	}
+	for _, r := range pending {
+		if r.timer.Stop() {
+			r.done(nil, ErrNotBound)
+		}
+	}
+}
+
+// read handles the PDUs sent by the SMSC until the connection is lost.
+func (c *Client) read(conn *smpp.Connection) error {
+	for {
+		p, err := conn.Decode()
+		if err != nil {
+			return err
+		}
+
+		var r pdu.Body
+		switch id := p.Header().ID; id {
+		case pdu.DeliverSMID:
+			r = pdu.NewDeliverSMRespSeq(p.Header().Seq)
+			r.Header().Status = c.deliver(p)
+		case pdu.EnquireLinkID:
+			r = pdu.NewEnquireLinkRespSeq(p.Header().Seq)
+		case pdu.UnbindID:
+			if err = conn.Serialize(pdu.NewUnbindRespSeq(p.Header().Seq)); err != nil {
+				return err
+			}
+			return errors.New("client: unbound by the SMSC")
+		default:
+			if id&0x80000000 != 0 { // Response
+				c.respond(p)
+				continue
+			}
+
+			r = pdu.NewGenericNACK()
+			r.Header().Seq = p.Header().Seq
+			r.Header().Status = 0x00000003 // Invalid Command ID
+		}
+
+		if err = conn.Serialize(r); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) deliver(p pdu.Body) pdu.Status {
+	if receipt, ok := ParseReceipt(p, c.config.Account.Alphabet()); ok {
+		if c.config.OnReceipt != nil {
+			return c.config.OnReceipt(receipt)
+		}
+		return 0
+	}
+
+	text, err := smpp.Text(p, c.config.Account.Alphabet())
+	if err != nil {
+		c.log.WithError(err).Warn("Could not decode the text")
+	}
+
+	if c.config.OnMessage != nil {
+		f := p.Fields()
+		return c.config.OnMessage(Message{
+			Src:  f[pdufield.SourceAddr].String(),
+			Dst:  f[pdufield.DestinationAddr].String(),
+			Text: text,
+			PDU:  p,
+		})
+	}
+	return 0
+}
+
+func (c *Client) respond(p pdu.Body) {
+	c.mu.Lock()
+	r, ok := c.pending[p.Header().Seq]
+	delete(c.pending, p.Header().Seq)
+	c.mu.Unlock()
+
+	if !ok {
+		c.log.Warnf("Unexpected %s (%d)", p.Header().ID, p.Header().Seq)
+		return
+	}
+
+	if r.timer.Stop() {
+		r.done(p, nil)
+	}
+}
+
+// keepalive sends the enquire_link and drops the connection when the SMSC does not answer.
+func (c *Client) keepalive() {
+	ticker := time.NewTicker(c.config.EnquireLink)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+		if conn == nil {
+			continue
+		}
+
+		if _, err := c.request(conn, pdu.NewEnquireLink()); err != nil && !errors.Is(err, ErrNotBound) {
+			c.log.WithError(err).Warn("enquire_link failed")
+			conn.Close()
+		}
+	}
+}
+
+// connection waits for the client to be bound.
+func (c *Client) connection() (*smpp.Connection, error) {
+	c.mu.Lock()
+	bound := c.bound
+	c.mu.Unlock()
+
+	select {
+	case <-c.closed:
+		return nil, ErrClosed
+	case <-bound:
+	case <-time.After(c.config.Timeout):
+		return nil, ErrNotBound
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil, ErrNotBound
+	}
+	return c.conn, nil
+}
+
+// send sends the given request and calls done with its response or error (e.g. ErrTimeout).
+func (c *Client) send(conn *smpp.Connection, p pdu.Body, done func(pdu.Body, error)) error {
+	seq := atomic.AddUint32(&c.sequence, 1)
+	p.Header().Seq = seq
+
+	r := &request{done: done}
+	r.timer = time.AfterFunc(c.config.Timeout, func() {
+		c.mu.Lock()
+		delete(c.pending, seq)
+		c.mu.Unlock()
+
+		done(nil, ErrTimeout)
+	})
+
+	c.mu.Lock()
+	c.pending[seq] = r
+	c.mu.Unlock()
+
+	if err := conn.Serialize(p); err != nil {
+		c.mu.Lock()
+		delete(c.pending, seq)
+		c.mu.Unlock()
+
+		if r.timer.Stop() {
+			return err
+		}
+		return nil // Already reported to done
+	}
+	return nil
+}
+
+// request sends the given request and waits for its response.
+// A response with a non-zero command_status is returned with its pdu.Status.
+func (c *Client) request(conn *smpp.Connection, p pdu.Body) (pdu.Body, error) {
+	type response struct {
+		p   pdu.Body
+		err error
+	}
+
+	ch := make(chan response, 1)
+	err := c.send(conn, p, func(p pdu.Body, err error) {
+		ch <- response{p: p, err: err}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := <-ch
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.p.Header().Status != 0 {
+		return r.p, r.p.Header().Status
+	}
+	return r.p, nil
+}
+
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,399 @@
+package client_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
+	"github.com/mdouchement/smsc3/client"
+	"github.com/mdouchement/smsc3/dlr"
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/mdouchement/smsc3/smsc"
+	"github.com/mdouchement/smsc3/smsctest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dial(t *testing.T, server *smsctest.Server, config client.Config) *client.Client {
+	config.Addr = server.Addr
+	config.Password = server.Password
+	if config.SystemID == "" {
+		config.SystemID = "esme"
+	}
+
+	c, err := client.Dial(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	_, err = server.WaitSession(config.SystemID, time.Second)
+	require.NoError(t, err)
+	return c
+}
+
+func message(text string) *smpp.Message {
+	c, _, _ := pdutext.SelectCodec(text)
+	return &smpp.Message{
+		Src:      "GOPHER",
+		Dst:      "+33600000001",
+		Text:     c,
+		Register: pdufield.FinalDeliveryReceipt,
+	}
+}
+
+func TestClient_Send(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+
+	receipts := make(chan client.Receipt, 4)
+	c := dial(t, server, client.Config{
+		OnReceipt: func(r client.Receipt) pdu.Status {
+			receipts <- r
+			return 0
+		},
+	})
+
+	ids, err := c.Send(message(strings.Repeat("long message ", 20)))
+	require.NoError(t, err)
+	assert.Len(t, ids, 2)
+
+	for i := 0; i < 2; i++ {
+		m, err := server.NextSubmitSM(time.Second, nil)
+		require.NoError(t, err)
+		assert.Equal(t, ids[i], m.MessageID())
+	}
+
+	select {
+	case r := <-receipts:
+		assert.Equal(t, ids[0], r.ID)
+		assert.Equal(t, "DELIVRD", r.Stat)
+		assert.Equal(t, 1, r.Dlvrd)
+		assert.True(t, r.Final)
+		assert.False(t, r.DoneDate.IsZero())
+	case <-time.After(3 * time.Second):
+		t.Fatal("DLR not received")
+	}
+
+	status, err := server.WaitDLRAck(ids[0], time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, pdu.Status(0), status)
+}
+
+func TestClient_Window(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+
+	c := dial(t, server, client.Config{Window: 2})
+
+	var submissions []*client.Submission
+	for i := 0; i < 10; i++ {
+		s, err := c.Submit(message("hello"))
+		require.NoError(t, err)
+		submissions = append(submissions, s)
+	}
+
+	seen := map[string]bool{}
+	for _, s := range submissions {
+		ids, err := s.Wait()
+		require.NoError(t, err)
+		require.Len(t, ids, 1)
+		seen[ids[0]] = true
+	}
+	assert.Len(t, seen, 10)
+}
+
+func TestClient_Parallel(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+
+	const n = 50
+	receipts := make(chan client.Receipt, 2*n)
+	c := dial(t, server, client.Config{
+		Window:      8,
+		EnquireLink: 5 * time.Millisecond,
+		OnReceipt: func(r client.Receipt) pdu.Status {
+			receipts <- r
+			return 0
+		},
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m := message(strings.Repeat("long message ", 20))
+			m.Dst = fmt.Sprintf("+336000000%02d", i) // The random references of the same recipient may collide
+			ids, err := c.Send(m)
+			if err == nil && len(ids) != 2 {
+				err = errors.Errorf("%d message_ids", len(ids))
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case <-receipts:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("%d DLRs received", i)
+		}
+	}
+	assert.True(t, c.Bound())
+}
+
+func TestClient_Message(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+
+	messages := make(chan client.Message, 1)
+	dial(t, server, client.Config{
+		BindType: client.Receiver,
+		OnMessage: func(m client.Message) pdu.Status {
+			messages <- m
+			return 0x45
+		},
+	})
+
+	err := server.Deliver("esme", message("Hello ESME"))
+	var status pdu.Status
+	assert.True(t, errors.As(err, &status))
+	assert.Equal(t, pdu.Status(0x45), status)
+
+	m := <-messages
+	assert.Equal(t, "Hello ESME", m.Text)
+	assert.Equal(t, "GOPHER", m.Src)
+}
+
+func TestClient_Receiver(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+
+	c := dial(t, server, client.Config{BindType: client.Receiver})
+	_, err := c.Send(message("hello"))
+	assert.Error(t, err)
+}
+
+func TestClient_Bind(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+
+	for _, bt := range []client.BindType{client.Transceiver, client.Transmitter, client.Receiver} {
+		c := dial(t, server, client.Config{SystemID: bt.String(), BindType: bt})
+		assert.True(t, c.Bound())
+	}
+
+	_, err := client.Dial(client.Config{Addr: server.Addr, SystemID: "esme", Password: "wrong"})
+	assert.Error(t, err)
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+
+	c := dial(t, server, client.Config{Reconnect: 50 * time.Millisecond})
+
+	session, err := server.WaitSession("esme", time.Second)
+	require.NoError(t, err)
+	session.Close() // Unbind asked by the SMSC
+
+	assert.Eventually(t, func() bool {
+		reconnected := server.SMSC.Session("esme")
+		return reconnected != nil && reconnected != session && c.Bound()
+	}, 3*time.Second, 10*time.Millisecond)
+
+	_, err = c.Send(message("hello again"))
+	assert.NoError(t, err)
+}
+
+func TestClient_ReceiptTemplate(t *testing.T) {
+	tlv, decimal := dlr.Presets["tlv"], dlr.Presets["decimal_id"]
+	server := smsctest.NewServer(&smsc.SMSC{
+		Accounts: []*smpp.Account{
+			{SystemID: "tlv", Password: "password", DLR: &tlv},
+			{SystemID: "decimal", Password: "password", DLR: &decimal},
+		},
+	})
+	defer server.Close()
+
+	for _, name := range []string{"tlv", "decimal"} {
+		receipts := make(chan client.Receipt, 1)
+		c := dial(t, server, client.Config{
+			SystemID: name,
+			OnReceipt: func(r client.Receipt) pdu.Status {
+				receipts <- r
+				return 0
+			},
+		})
+
+		ids, err := c.Send(message("hello"))
+		require.NoError(t, err)
+
+		select {
+		case r := <-receipts:
+			assert.Equal(t, ids[0], r.ID) // receipted_message_id
+			assert.Equal(t, "DELIVRD", r.Stat)
+
+			text := string(r.PDU.Fields()[pdufield.ShortMessage].Bytes())
+			switch name {
+			case "tlv":
+				assert.Empty(t, text)
+				assert.NotNil(t, r.PDU.TLVFields()[pdutlv.TagMessageStateOption])
+			case "decimal":
+				assert.Contains(t, text, "id:"+decimal.FormatID(ids[0])+" ")
+				assert.Contains(t, text, "Text:hello")
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("DLR not received")
+		}
+	}
+}
+
+func TestClient_ReceiptOutcome(t *testing.T) {
+	server := smsctest.NewServer(&smsc.SMSC{
+		Accounts: []*smpp.Account{{
+			SystemID: "esme",
+			Password: "password",
+			Outcomes: []*dlr.Rule{
+				{Match: `^\+336999`, Stat: "UNDELIV", Err: 1},
+				{Match: `^\+336998`, Stat: "EXPIRED", Err: 27, Network: "ansi136"},
+			},
+		}},
+	})
+	defer server.Close()
+
+	receipts := make(chan client.Receipt, 3)
+	c := dial(t, server, client.Config{
+		OnReceipt: func(r client.Receipt) pdu.Status {
+			receipts <- r
+			return 0
+		},
+	})
+
+	tests := []struct {
+		dst     string
+		stat    string
+		err     int
+		state   dlr.State
+		network []byte
+	}{
+		{dst: "+33600000001", stat: "DELIVRD", state: dlr.Delivered},
+		{dst: "+33699900001", stat: "UNDELIV", err: 1, state: dlr.Undeliverable, network: []byte{3, 0, 1}},
+		{dst: "+33699800001", stat: "EXPIRED", err: 27, state: dlr.Expired, network: []byte{1, 0, 27}},
+	}
+
+	expected := map[string]int{}
+	for i, tt := range tests {
+		m := message("hello")
+		m.Dst = tt.dst
+		ids, err := c.Send(m)
+		require.NoError(t, err)
+		expected[ids[0]] = i
+	}
+
+	for range tests {
+		select {
+		case r := <-receipts:
+			i, ok := expected[r.ID]
+			require.True(t, ok)
+			tt := tests[i]
+
+			assert.Equal(t, tt.stat, r.Stat)
+			assert.Equal(t, tt.err, r.Err)
+
+			tlv := r.PDU.TLVFields()
+			assert.Equal(t, []byte{uint8(tt.state)}, tlv[pdutlv.TagMessageStateOption].Bytes())
+			if tt.network == nil {
+				assert.Nil(t, tlv[pdutlv.TagNetworkErrorCode])
+			} else {
+				assert.Equal(t, tt.network, tlv[pdutlv.TagNetworkErrorCode].Bytes())
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("DLR not received")
+		}
+	}
+}
+
+func TestClient_ReceiptPacked(t *testing.T) {
+	template := dlr.Presets["smpp34"]
+	account := &smpp.Account{SystemID: "esme", Password: "password", GSM7: smpp.GSM7Packed, DLR: &template}
+	server := smsctest.NewServer(&smsc.SMSC{Accounts: []*smpp.Account{account}})
+	defer server.Close()
+
+	receipts := make(chan client.Receipt, 1)
+	c := dial(t, server, client.Config{
+		Account: account,
+		OnReceipt: func(r client.Receipt) pdu.Status {
+			receipts <- r
+			return 0
+		},
+	})
+
+	ids, err := c.Send(message("hello"))
+	require.NoError(t, err)
+
+	select {
+	case r := <-receipts:
+		assert.Equal(t, ids[0], r.ID)
+		assert.Equal(t, 1, r.Sub)
+		assert.Equal(t, "DELIVRD", r.Stat)
+		assert.False(t, r.SubmitDate.IsZero())
+		assert.False(t, r.DoneDate.IsZero())
+		assert.Equal(t, "hello", r.Text)
+	case <-time.After(3 * time.Second):
+		t.Fatal("DLR not received")
+	}
+}
+
+func TestParseReceipt(t *testing.T) {
+	p := pdu.NewDeliverSM()
+	p.Fields().Set(pdufield.ESMClass, 0b100)
+	p.Fields().Set(pdufield.SourceAddr, "33600000001")
+	p.Fields().Set(pdufield.ShortMessage, "id:42 sub:001 dlvrd:000 submit date:2410191200 done date:241019120130 stat:UNDELIV err:069 text:Hello world")
+
+	r, ok := client.ParseReceipt(p, pdutext.DefaultGSM7)
+	require.True(t, ok)
+	assert.Equal(t, "42", r.ID)
+	assert.Equal(t, "33600000001", r.Src)
+	assert.Equal(t, 1, r.Sub)
+	assert.Equal(t, 0, r.Dlvrd)
+	assert.Equal(t, time.Date(2024, 10, 19, 12, 0, 0, 0, time.Local), r.SubmitDate)
+	assert.Equal(t, time.Date(2024, 10, 19, 12, 1, 30, 0, time.Local), r.DoneDate)
+	assert.Equal(t, "UNDELIV", r.Stat)
+	assert.Equal(t, 69, r.Err)
+	assert.Equal(t, "Hello world", r.Text)
+	assert.True(t, r.Final)
+
+	p.TLVFields().Set(pdutlv.TagReceiptedMessageID, pdutlv.CString("43"))
+	p.Fields().Set(pdufield.ESMClass, 0b100000)
+	r, ok = client.ParseReceipt(p, pdutext.DefaultGSM7)
+	require.True(t, ok)
+	assert.Equal(t, "43", r.ID)
+	assert.False(t, r.Final)
+
+	p = pdu.NewDeliverSM() // TLV only
+	p.Fields().Set(pdufield.ESMClass, 0b100)
+	p.TLVFields().Set(pdutlv.TagReceiptedMessageID, pdutlv.CString("44"))
+	p.TLVFields().Set(pdutlv.TagMessageStateOption, uint8(dlr.Undeliverable))
+	p.TLVFields().Set(pdutlv.TagNetworkErrorCode, []byte{3, 0, 69})
+	r, ok = client.ParseReceipt(p, pdutext.DefaultGSM7)
+	require.True(t, ok)
+	assert.Equal(t, "44", r.ID)
+	assert.Equal(t, "UNDELIV", r.Stat)
+	assert.Equal(t, 69, r.Err)
+
+	_, ok = client.ParseReceipt(pdu.NewDeliverSM(), pdutext.DefaultGSM7)
+	assert.False(t, ok)
+}
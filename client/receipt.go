@@ -0,0 +1,74 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
+	"github.com/mdouchement/smsc3/dlr"
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/mdouchement/smsc3/smpp"
+)
+
+// esm_class message types of the DLRs (SMPP 3.4 §5.2.12).
+const (
+	esmClassType         = 0b0011_1100
+	esmClassReceipt      = 0b0000_0100 // SMSC Delivery Receipt
+	esmClassIntermediate = 0b0010_0000 // Intermediate Delivery Notification
+)
+
+// A Receipt is a DLR sent by the SMSC.
+type Receipt struct {
+	dlr.Receipt
+	Src   string // Recipient of the submitted message
+	Dst   string // Originator of the submitted message
+	Final bool   // False for an intermediate notification (e.g. ENROUTE, ACCEPTD)
+	PDU   pdu.Body
+}
+
+// ParseReceipt returns the DLR carried by the given deliver_sm, if any.
+// The text is decoded according to its data_coding, the given alphabet being the SMSC default one (see smpp.Account.Alphabet).
+// The receipted_message_id TLV takes precedence over the id of the text,
+// the message_state and network_error_code TLVs are used when the text has no stat or err.
+func ParseReceipt(p pdu.Body, alphabet pdutext.DefaultAlphabet) (Receipt, bool) {
+	f := p.Fields()
+
+	var esmclass uint8
+	if v := f[pdufield.ESMClass]; v != nil && len(v.Bytes()) > 0 {
+		esmclass = v.Bytes()[0]
+	}
+	switch esmclass & esmClassType {
+	case esmClassReceipt, esmClassIntermediate:
+	default:
+		return Receipt{}, false
+	}
+
+	r := Receipt{
+		Final: esmclass&esmClassType == esmClassReceipt,
+		PDU:   p,
+	}
+	if v := f[pdufield.SourceAddr]; v != nil {
+		r.Src = v.String()
+	}
+	if v := f[pdufield.DestinationAddr]; v != nil {
+		r.Dst = v.String()
+	}
+
+	text, _ := smpp.Text(p, alphabet)
+	r.Receipt, _ = dlr.Parse(text) // Only the TLVs may be given
+
+	tlv := p.TLVFields()
+	if v := tlv[pdutlv.TagReceiptedMessageID]; v != nil {
+		r.ID = strings.TrimRight(v.String(), "\x00")
+	}
+	if v := tlv[pdutlv.TagMessageStateOption]; v != nil && len(v.Bytes()) == 1 && r.Stat == "" {
+		r.Stat = dlr.State(v.Bytes()[0]).Stat()
+	}
+	if v := tlv[pdutlv.TagNetworkErrorCode]; v != nil && len(v.Bytes()) == 3 && r.Err == 0 {
+		b := v.Bytes() // Network type and error code
+		r.Err = int(b[1])<<8 | int(b[2])
+	}
+
+	return r, true
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/pkg/errors"
+)
+
+// A Submission is a message submitted to the SMSC, one submit_sm per segment.
+type Submission struct {
+	mu        sync.Mutex
+	done      chan struct{}
+	ids       []string
+	err       error
+	remaining int
+	sealed    bool // All the segments are sent
+}
+
+// Send submits the given message and waits for the submit_sm_resp of all its segments.
+// It returns the message_id of each segment. A rejected segment returns its pdu.Status.
+func (c *Client) Send(m *smpp.Message) ([]string, error) {
+	s, err := c.Submit(m)
+	if err != nil {
+		return nil, err
+	}
+	return s.Wait()
+}
+
+// Submit submits the given message without waiting for the submit_sm_resp, see Submission.Wait.
+// The text is split in segments when it does not fit in a single short message.
+// Submit blocks while the window of unacknowledged submit_sm is full.
+func (c *Client) Submit(m *smpp.Message) (*Submission, error) {
+	if c.config.BindType == Receiver {
+		return nil, errors.New("client: a receiver can not submit messages")
+	}
+
+	conn, err := c.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Submission{done: make(chan struct{})}
+
+	m.Text = c.config.Account.Codec(m.Text, m.CodingGroup())
+	err = m.Encode(pdu.NewSubmitSM(nil), uint8(rand.Intn(0xFF)), func(p pdu.Body) error {
+		select {
+		case c.window <- struct{}{}:
+		case <-c.closed:
+			return ErrClosed
+		}
+
+		i := s.add()
+		err := c.send(conn, p, func(r pdu.Body, err error) {
+			<-c.window
+			s.resolve(i, r, err)
+		})
+		if err != nil {
+			<-c.window
+			s.resolve(i, nil, err)
+		}
+		return err
+	})
+	s.seal()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "client: submit_sm")
+	}
+	return s, nil
+}
+
+// Done returns a channel closed when all the segments are acknowledged (or failed).
+func (s *Submission) Done() <-chan struct{} {
+	return s.done
+}
+
+// Wait waits for the submit_sm_resp of all the segments and returns their message_id.
+// The error is the first failure of a segment, a pdu.Status when it has been rejected by the SMSC.
+func (s *Submission) Wait() ([]string, error) {
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ids, s.err
+}
+
+// add adds a segment and returns its index.
+func (s *Submission) add() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ids = append(s.ids, "")
+	s.remaining++
+	return len(s.ids) - 1
+}
+
+func (s *Submission) resolve(i int, r pdu.Body, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case err != nil:
+	case r.Header().Status != 0:
+		err = r.Header().Status
+	default:
+		if v := r.Fields()[pdufield.MessageID]; v != nil {
+			s.ids[i] = v.String()
+		}
+	}
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+
+	s.remaining--
+	s.close()
+}
+
+func (s *Submission) seal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sealed = true
+	s.close()
+}
+
+// close closes the done channel once all the segments are resolved, the lock must be held.
+func (s *Submission) close() {
+	if s.sealed && s.remaining == 0 {
+		close(s.done)
+	}
+}
@@ -0,0 +1,193 @@
+// Package dlr formats and parses the delivery receipts (SMPP 3.4 Appendix B):
+//
+//	id:IIIIIIIIII sub:SSS dlvrd:DDD submit date:YYMMDDhhmm done date:YYMMDDhhmm stat:DDDDDDD err:E text:...
+//
+// The parser is tolerant of the vendor variants: case of the keys, underscores in the date keys,
+// dates with seconds, missing fields and hexadecimal error codes.
+package dlr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Date layouts used in the receipts.
+const (
+	DateLayout        = "0601021504"     // YYMMDDhhmm
+	DateLayoutSeconds = "060102150405"   // YYMMDDhhmmss
+	DateLayoutLong    = "20060102150405" // YYYYMMDDhhmmss, used by some vendors
+)
+
+// Message states of the message_state TLV (SMPP 3.4 §5.3.2.35).
+const (
+	Enroute       State = 1
+	Delivered     State = 2
+	Expired       State = 3
+	Deleted       State = 4
+	Undeliverable State = 5
+	Accepted      State = 6
+	Unknown       State = 7
+	Rejected      State = 8
+)
+
+var (
+	states = map[State][2]string{
+		Enroute:       {"ENROUTE", "ENROUTE"},
+		Delivered:     {"DELIVERED", "DELIVRD"},
+		Expired:       {"EXPIRED", "EXPIRED"},
+		Deleted:       {"DELETED", "DELETED"},
+		Undeliverable: {"UNDELIVERABLE", "UNDELIV"},
+		Accepted:      {"ACCEPTED", "ACCEPTD"},
+		Unknown:       {"UNKNOWN", "UNKNOWN"},
+		Rejected:      {"REJECTED", "REJECTD"},
+	}
+
+	keyRE = regexp.MustCompile(`(?i)(?:^|\s)(id|sub|dlvrd|submit[ _]?date|done[ _]?date|stat|err|text):`)
+)
+
+type (
+	// A State is the state of a message.
+	State uint8
+
+	// A Receipt is a delivery receipt.
+	Receipt struct {
+		ID         string    `json:"id"`          // message_id given in the submit_sm_resp
+		Sub        int       `json:"sub"`         // Number of short messages originally submitted
+		Dlvrd      int       `json:"dlvrd"`       // Number of short messages delivered
+		SubmitDate time.Time `json:"submit_date"` // Submission of the message
+		DoneDate   time.Time `json:"done_date"`   // Final state of the message
+		Stat       string    `json:"stat"`        // Final status (e.g. DELIVRD, UNDELIV), see State.Stat
+		Err        int       `json:"err"`         // Network specific error code
+		Text       string    `json:"text"`        // First characters of the message
+	}
+)
+
+// ParseState returns the state of the given stat, its short (e.g. UNDELIV) or long (e.g. UNDELIVERABLE) name.
+func ParseState(stat string) (State, bool) {
+	stat = strings.ToUpper(strings.TrimSpace(stat))
+	for state, names := range states {
+		if stat == names[0] || stat == names[1] {
+			return state, true
+		}
+	}
+	return 0, false
+}
+
+// String returns the long name of the state (e.g. UNDELIVERABLE).
+func (s State) String() string {
+	if names, ok := states[s]; ok {
+		return names[0]
+	}
+	return fmt.Sprintf("STATE(%d)", uint8(s))
+}
+
+// Stat returns the name of the state used in the stat field of the receipts (e.g. UNDELIV).
+func (s State) Stat() string {
+	if names, ok := states[s]; ok {
+		return names[1]
+	}
+	return "UNKNOWN"
+}
+
+// Valid returns true if the state is defined by SMPP 3.4.
+func (s State) Valid() bool {
+	_, ok := states[s]
+	return ok
+}
+
+// Intermediate returns true if the state is reported by an intermediate notification (ENROUTE and ACCEPTD).
+func (s State) Intermediate() bool {
+	return s == Enroute || s == Accepted
+}
+
+// State returns the state of the stat field, Unknown when not recognized.
+func (r Receipt) State() State {
+	if state, ok := ParseState(r.Stat); ok {
+		return state
+	}
+	return Unknown
+}
+
+// String formats the receipt with the default template and 10-digit dates, see Template.Format.
+// The text field is omitted when empty.
+func (r Receipt) String() string {
+	return Template{Text: r.Text != ""}.Format(r)
+}
+
+// Parse parses the text of a delivery receipt.
+// The value of a field lasts until the next key, the text field lasts until the end.
+func Parse(s string) (Receipt, error) {
+	var r Receipt
+
+	keys := keyRE.FindAllStringSubmatchIndex(s, -1)
+	if len(keys) == 0 {
+		return r, errors.New("dlr: not a delivery receipt")
+	}
+
+	for i, k := range keys {
+		key := strings.ToLower(s[k[2]:k[3]])
+		end := len(s)
+		if i+1 < len(keys) && key != "text" {
+			end = keys[i+1][0]
+		}
+		value := strings.TrimSpace(s[k[1]:end])
+
+		switch strings.NewReplacer(" ", "", "_", "").Replace(key) {
+		case "id":
+			r.ID = value
+		case "sub":
+			r.Sub, _ = strconv.Atoi(value)
+		case "dlvrd":
+			r.Dlvrd, _ = strconv.Atoi(value)
+		case "submitdate":
+			r.SubmitDate = ParseDate(value)
+		case "donedate":
+			r.DoneDate = ParseDate(value)
+		case "stat":
+			r.Stat = strings.ToUpper(value)
+			if state, ok := ParseState(value); ok {
+				r.Stat = state.Stat()
+			}
+		case "err":
+			r.Err = parseErr(value)
+		case "text":
+			r.Text = value
+			return r, nil
+		}
+	}
+
+	return r, nil
+}
+
+// ParseDate parses a date of a receipt in one of the date layouts, zero when invalid.
+func ParseDate(s string) time.Time {
+	var layout string
+	switch len(s) {
+	case len(DateLayout):
+		layout = DateLayout
+	case len(DateLayoutSeconds):
+		layout = DateLayoutSeconds
+	case len(DateLayoutLong):
+		layout = DateLayoutLong
+	default:
+		return time.Time{}
+	}
+
+	t, _ := time.ParseInLocation(layout, s, time.Local)
+	return t
+}
+
+// parseErr parses a decimal error code, or an hexadecimal one (e.g. 00A or 0x0A).
+func parseErr(s string) int {
+	if v, err := strconv.Atoi(s); err == nil {
+		return v
+	}
+
+	v, _ := strconv.ParseInt(strings.TrimPrefix(strings.ToLower(s), "0x"), 16, 32)
+	return int(v)
+}
@@ -0,0 +1,110 @@
+package dlr_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdouchement/smsc3/dlr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceipt(t *testing.T) {
+	date := time.Date(2024, 10, 19, 12, 1, 0, 0, time.Local)
+	r := dlr.Receipt{
+		ID:         "42",
+		Sub:        1,
+		Dlvrd:      1,
+		SubmitDate: date,
+		DoneDate:   date,
+		Stat:       dlr.Delivered.Stat(),
+	}
+	assert.Equal(t, "id:42 sub:001 dlvrd:001 submit date:2410191201 done date:2410191201 stat:DELIVRD err:000", r.String())
+
+	parsed, err := dlr.Parse(r.String())
+	require.NoError(t, err)
+	assert.Equal(t, r, parsed)
+	assert.Equal(t, dlr.Delivered, parsed.State())
+
+	r.Text = "Hello id:43 world"
+	assert.Contains(t, r.String(), " Text:Hello id:43 world") // Same as the default template
+	parsed, err = dlr.Parse(r.String())
+	require.NoError(t, err)
+	assert.Equal(t, r, parsed)
+
+	r.Stat, r.Err = dlr.Undeliverable.Stat(), 0x1234
+	assert.Contains(t, r.String(), " err:999 ")
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want dlr.Receipt
+	}{
+		{
+			name: "standard",
+			text: "id:0123456789 sub:001 dlvrd:000 submit date:2410191200 done date:2410191201 stat:UNDELIV err:069 text:Hello world",
+			want: dlr.Receipt{
+				ID: "0123456789", Sub: 1,
+				SubmitDate: time.Date(2024, 10, 19, 12, 0, 0, 0, time.Local),
+				DoneDate:   time.Date(2024, 10, 19, 12, 1, 0, 0, time.Local),
+				Stat:       "UNDELIV", Err: 69, Text: "Hello world",
+			},
+		},
+		{
+			name: "seconds and capitalized text",
+			text: "id:ABCDEF sub:001 dlvrd:001 submit date:241019120005 done date:241019120130 stat:DELIVRD err:000 Text:Hi",
+			want: dlr.Receipt{
+				ID: "ABCDEF", Sub: 1, Dlvrd: 1,
+				SubmitDate: time.Date(2024, 10, 19, 12, 0, 5, 0, time.Local),
+				DoneDate:   time.Date(2024, 10, 19, 12, 1, 30, 0, time.Local),
+				Stat:       "DELIVRD", Text: "Hi",
+			},
+		},
+		{
+			name: "lowercase keys and long stat",
+			text: "ID:7 SUB:1 DLVRD:0 SUBMIT_DATE:20241019120000 DONE_DATE:20241019120100 STAT:undeliverable ERR:0x0A",
+			want: dlr.Receipt{
+				ID: "7", Sub: 1,
+				SubmitDate: time.Date(2024, 10, 19, 12, 0, 0, 0, time.Local),
+				DoneDate:   time.Date(2024, 10, 19, 12, 1, 0, 0, time.Local),
+				Stat:       "UNDELIV", Err: 10,
+			},
+		},
+		{
+			name: "missing fields",
+			text: "id:8 stat:EXPIRED",
+			want: dlr.Receipt{ID: "8", Stat: "EXPIRED"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := dlr.Parse(tt.text)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, r)
+		})
+	}
+
+	_, err := dlr.Parse("Hello world")
+	assert.Error(t, err)
+}
+
+func TestState(t *testing.T) {
+	state, ok := dlr.ParseState("delivered")
+	assert.True(t, ok)
+	assert.Equal(t, dlr.Delivered, state)
+	assert.Equal(t, "DELIVRD", state.Stat())
+	assert.Equal(t, "DELIVERED", state.String())
+
+	state, ok = dlr.ParseState("REJECTD")
+	assert.True(t, ok)
+	assert.Equal(t, dlr.Rejected, state)
+	assert.False(t, state.Intermediate())
+	assert.True(t, dlr.Accepted.Intermediate())
+
+	_, ok = dlr.ParseState("FAILED")
+	assert.False(t, ok)
+	assert.False(t, dlr.State(9).Valid())
+}
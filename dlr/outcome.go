@@ -0,0 +1,104 @@
+package dlr
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Network types of the network_error_code TLV (SMPP 3.4 §5.3.2.31).
+const (
+	NetworkANSI136 uint8 = 1
+	NetworkIS95    uint8 = 2
+	NetworkGSM     uint8 = 3
+)
+
+var networks = map[string]uint8{
+	"ansi136": NetworkANSI136,
+	"is95":    NetworkIS95,
+	"gsm":     NetworkGSM,
+}
+
+type (
+	// An Outcome is the delivery outcome of a message reported by a DLR.
+	Outcome struct {
+		State   State
+		Err     int   // Error code of the err field and of the network_error_code TLV
+		Network uint8 // Network type of the network_error_code TLV
+	}
+
+	// A Rule decides the outcome of the messages sent to the matching destinations.
+	Rule struct {
+		Match   string `json:"match"`   // Regular expression on the destination number (e.g. ^\+33699), all the numbers when empty
+		Stat    string `json:"stat"`    // Short or long name of the state, DELIVRD by default
+		Err     int    `json:"err"`     // Error code of a failure
+		Network string `json:"network"` // gsm (default), ansi136 or is95
+
+		re      *regexp.Regexp
+		state   State
+		network uint8
+	}
+)
+
+// Failed returns true if the message has not been delivered and will not be.
+func (o Outcome) Failed() bool {
+	return !o.State.Intermediate() && o.State != Delivered
+}
+
+// NetworkErrorCode returns the value of the network_error_code TLV, nil when the message is not failed.
+func (o Outcome) NetworkErrorCode() []byte {
+	if !o.Failed() || o.Err == 0 {
+		return nil
+	}
+
+	network := o.Network
+	if network == 0 {
+		network = NetworkGSM
+	}
+	return []byte{network, byte(o.Err >> 8), byte(o.Err)}
+}
+
+// Compile compiles the rule.
+func (r *Rule) Compile() (err error) {
+	if r.Match != "" {
+		if r.re, err = regexp.Compile(r.Match); err != nil {
+			return errors.Wrap(err, "dlr: rule")
+		}
+	}
+
+	r.state = Delivered
+	if r.Stat != "" {
+		var ok bool
+		if r.state, ok = ParseState(r.Stat); !ok {
+			return errors.Errorf("dlr: rule: invalid stat %q", r.Stat)
+		}
+	}
+
+	r.network = NetworkGSM
+	if r.Network != "" {
+		var ok bool
+		if r.network, ok = networks[strings.ToLower(r.Network)]; !ok {
+			return errors.Errorf("dlr: rule: invalid network %q", r.Network)
+		}
+	}
+
+	if r.Err < 0 || r.Err > 0xFFFF {
+		return errors.Errorf("dlr: rule: invalid err %d", r.Err)
+	}
+	return nil
+}
+
+// Matches returns true if the rule applies to the given destination number.
+func (r *Rule) Matches(dst string) bool {
+	return r.re == nil || r.re.MatchString(dst)
+}
+
+// Outcome returns the outcome of the messages matched by the rule.
+func (r *Rule) Outcome() Outcome {
+	o := Outcome{State: r.state, Network: r.network}
+	if o.Failed() {
+		o.Err = r.Err
+	}
+	return o
+}
@@ -0,0 +1,35 @@
+package dlr_test
+
+import (
+	"testing"
+
+	"github.com/mdouchement/smsc3/dlr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRule(t *testing.T) {
+	rule := &dlr.Rule{Match: `^\+33699`, Stat: "undeliverable", Err: 0x0101, Network: "is95"}
+	require.NoError(t, rule.Compile())
+
+	assert.True(t, rule.Matches("+33699000001"))
+	assert.False(t, rule.Matches("+33600000001"))
+
+	o := rule.Outcome()
+	assert.Equal(t, dlr.Outcome{State: dlr.Undeliverable, Err: 0x0101, Network: dlr.NetworkIS95}, o)
+	assert.True(t, o.Failed())
+	assert.Equal(t, []byte{2, 0x01, 0x01}, o.NetworkErrorCode())
+
+	rule = &dlr.Rule{Err: 12} // Delivered, the err is ignored
+	require.NoError(t, rule.Compile())
+	assert.True(t, rule.Matches("+33600000001"))
+	o = rule.Outcome()
+	assert.Equal(t, dlr.Delivered, o.State)
+	assert.Equal(t, 0, o.Err)
+	assert.Nil(t, o.NetworkErrorCode())
+
+	assert.Error(t, (&dlr.Rule{Match: "("}).Compile())
+	assert.Error(t, (&dlr.Rule{Stat: "FAILED"}).Compile())
+	assert.Error(t, (&dlr.Rule{Network: "cdma"}).Compile())
+	assert.Error(t, (&dlr.Rule{Err: 0x10000}).Compile())
+}
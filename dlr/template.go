@@ -0,0 +1,183 @@
+package dlr
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TLVs that can be set in the DLRs.
+const (
+	TLVReceiptedMessageID = "receipted_message_id"
+	TLVMessageState       = "message_state"
+	TLVNetworkErrorCode   = "network_error_code"
+)
+
+// Formats of the id field.
+const (
+	IDDecimal = "decimal"
+	IDHex     = "hex"
+)
+
+// base62 is the charset of the message_ids generated by smsc3.
+const base62 = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// A Template tells how the DLRs are crafted. The zero value is the historical text format of smsc3 with all the TLVs.
+// In JSON, a template is either an object or the name of a preset.
+type Template struct {
+	Text      bool     `json:"text"`      // Adds the first 20 characters of the message in the text field
+	Lowercase bool     `json:"lowercase"` // Lowercase text key, Text as in SMPP 3.4 Appendix B otherwise
+	Seconds   bool     `json:"seconds"`   // 12-digit dates (YYMMDDhhmmss) instead of 10-digit ones
+	ID        string   `json:"id"`        // decimal or hex to convert the message_id in the id field, see FormatID
+	TLVOnly   bool     `json:"tlv_only"`  // No short_message, the receipt is only carried by the TLVs
+	TLVs      []string `json:"tlvs"`      // Set TLVs, all by default
+}
+
+// Presets are the templates of common SMSC styles, selected by name.
+var Presets = map[string]Template{
+	"default": {},
+	// SMPP 3.4 Appendix B, used by most SMSCs.
+	"smpp34": {Text: true},
+	// Lowercase text key and message_state TLV, in the style of Jasmin.
+	"jasmin": {Text: true, Lowercase: true, TLVs: []string{TLVReceiptedMessageID, TLVMessageState}},
+	// Dates with seconds.
+	"seconds": {Text: true, Seconds: true},
+	// Decimal id in the text, the message_id being returned as is in the submit_sm_resp (see Kannel's msg-id-type).
+	"decimal_id": {Text: true, ID: IDDecimal},
+	// Hexadecimal id in the text.
+	"hex_id": {Text: true, ID: IDHex},
+	// No text, only the TLVs.
+	"tlv": {TLVOnly: true},
+}
+
+// Format formats the receipt with the template. The err field is clamped to 999.
+func (t Template) Format(r Receipt) string {
+	if t.TLVOnly {
+		return ""
+	}
+
+	layout := DateLayout
+	if t.Seconds {
+		layout = DateLayoutSeconds
+	}
+
+	s := fmt.Sprintf("id:%s sub:%03d dlvrd:%03d submit date:%s done date:%s stat:%s err:%03d",
+		t.FormatID(r.ID), r.Sub, r.Dlvrd, r.SubmitDate.Format(layout), r.DoneDate.Format(layout), r.Stat, errCode(r.Err))
+	if t.Text {
+		key := "Text"
+		if t.Lowercase {
+			key = "text"
+		}
+		s += " " + key + ":" + truncate(r.Text, 20)
+	}
+	return s
+}
+
+// FormatID formats the id field. The message_ids generated by smsc3 are numbers in base 62,
+// they are converted in decimal or hexadecimal according to the ID format.
+func (t Template) FormatID(id string) string {
+	if t.ID == "" {
+		return id
+	}
+
+	var n uint64
+	for _, c := range id {
+		i := strings.IndexRune(base62, c)
+		if i < 0 {
+			return id // Not generated by smsc3
+		}
+		n = n*62 + uint64(i)
+	}
+
+	if t.ID == IDHex {
+		return strconv.FormatUint(n, 16)
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+// Has returns true if the given TLV is set in the DLRs.
+func (t Template) Has(tlv string) bool {
+	if t.TLVs == nil {
+		return true
+	}
+
+	for _, v := range t.TLVs {
+		if v == tlv {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error when the template is invalid.
+func (t Template) Validate() error {
+	switch t.ID {
+	case "", IDDecimal, IDHex:
+	default:
+		return errors.Errorf("dlr: invalid id format %q", t.ID)
+	}
+
+	for _, v := range t.TLVs {
+		switch v {
+		case TLVReceiptedMessageID, TLVMessageState, TLVNetworkErrorCode:
+		default:
+			return errors.Errorf("dlr: unsupported TLV %q", v)
+		}
+	}
+
+	if t.TLVOnly && !t.Has(TLVReceiptedMessageID) {
+		return errors.New("dlr: a TLV only receipt needs the receipted_message_id")
+	}
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Template) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		preset, ok := Presets[name]
+		if !ok {
+			names := make([]string, 0, len(Presets))
+			for name := range Presets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return errors.Errorf("dlr: unknown preset %q, want one of %s", name, strings.Join(names, ", "))
+		}
+
+		*t = preset
+		return nil
+	}
+
+	type template Template // Without UnmarshalJSON
+	var v template
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*t = Template(v)
+	return t.Validate()
+}
+
+// errCode clamps the given error code to the 3 digits of the err field,
+// the network_error_code TLV reports the full code.
+func errCode(code int) int {
+	switch {
+	case code < 0:
+		return 0
+	case code > 999:
+		return 999
+	}
+	return code
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
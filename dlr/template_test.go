@@ -0,0 +1,87 @@
+package dlr_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/smsc3/dlr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Format(t *testing.T) {
+	date := time.Date(2024, 10, 19, 12, 1, 30, 0, time.Local)
+	r := dlr.Receipt{
+		ID:         "1U6i7TeNjcE",
+		Sub:        1,
+		SubmitDate: date,
+		DoneDate:   date,
+		Stat:       "UNDELIV",
+		Err:        69,
+		Text:       "Hello world, this is a long message",
+	}
+
+	tests := []struct {
+		name     string
+		template dlr.Template
+		want     string
+	}{
+		{
+			name: "default",
+			want: "id:1U6i7TeNjcE sub:001 dlvrd:000 submit date:2410191201 done date:2410191201 stat:UNDELIV err:069",
+		},
+		{
+			name:     "smpp34",
+			template: dlr.Presets["smpp34"],
+			want:     "id:1U6i7TeNjcE sub:001 dlvrd:000 submit date:2410191201 done date:2410191201 stat:UNDELIV err:069 Text:Hello world, this is",
+		},
+		{
+			name:     "lowercase with seconds",
+			template: dlr.Template{Text: true, Lowercase: true, Seconds: true},
+			want:     "id:1U6i7TeNjcE sub:001 dlvrd:000 submit date:241019120130 done date:241019120130 stat:UNDELIV err:069 text:Hello world, this is",
+		},
+		{
+			name:     "tlv only",
+			template: dlr.Presets["tlv"],
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.template.Format(r))
+		})
+	}
+}
+
+func TestTemplate_FormatID(t *testing.T) {
+	assert.Equal(t, "1U6i7TeNjcE", dlr.Template{}.FormatID("1U6i7TeNjcE"))
+	assert.Equal(t, "3843", dlr.Template{ID: dlr.IDDecimal}.FormatID("ZZ"))
+	assert.Equal(t, "f03", dlr.Template{ID: dlr.IDHex}.FormatID("ZZ"))
+	assert.Equal(t, "not-base62", dlr.Template{ID: dlr.IDHex}.FormatID("not-base62"))
+}
+
+func TestTemplate_UnmarshalJSON(t *testing.T) {
+	var v struct {
+		DLR dlr.Template `json:"dlr"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(`{"dlr": "tlv"}`), &v))
+	assert.Equal(t, dlr.Presets["tlv"], v.DLR)
+	assert.True(t, v.DLR.Has(dlr.TLVMessageState))
+
+	require.NoError(t, json.Unmarshal([]byte(`{"dlr": {"text": true, "id": "hex"}}`), &v))
+	assert.Equal(t, dlr.Template{Text: true, ID: dlr.IDHex}, v.DLR)
+	assert.True(t, v.DLR.Has(dlr.TLVReceiptedMessageID))
+	assert.True(t, v.DLR.Has(dlr.TLVNetworkErrorCode)) // All by default
+
+	require.NoError(t, json.Unmarshal([]byte(`{"dlr": {"tlvs": ["receipted_message_id"]}}`), &v))
+	assert.True(t, v.DLR.Has(dlr.TLVReceiptedMessageID))
+	assert.False(t, v.DLR.Has(dlr.TLVMessageState))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"dlr": "unknown"}`), &v))
+	assert.Error(t, json.Unmarshal([]byte(`{"dlr": {"id": "octal"}}`), &v))
+	assert.Error(t, json.Unmarshal([]byte(`{"dlr": {"tlvs": ["sar_msg_ref_num"]}}`), &v))
+	assert.Error(t, json.Unmarshal([]byte(`{"dlr": {"tlv_only": true, "tlvs": ["message_state"]}}`), &v))
+}
@@ -0,0 +1,116 @@
+package handset
+
+import (
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// A Handset is a virtual handset answering automatically the messages it receives.
+	Handset struct {
+		MSISDN string  `json:"msisdn"`
+		Rules  []*Rule `json:"rules"` // The first matching rule answers
+
+		mu      sync.Mutex
+		stopped map[string]bool // Originators answered with STOP
+	}
+
+	// A Rule answers the messages matching a regular expression.
+	Rule struct {
+		Match string `json:"match"` // Regular expression, all the messages match when empty
+		Reply string `json:"reply"` // Capture groups can be used with $1 or ${name}
+		Delay string `json:"delay"` // Duration before replying (e.g. 2s)
+		Stop  bool   `json:"stop"`  // Replies STOP (by default) and opts out the originator
+
+		re    *regexp.Regexp
+		delay time.Duration
+	}
+
+	// A Reply is an answer of a handset.
+	Reply struct {
+		Text  string
+		Delay time.Duration
+	}
+)
+
+// Compile compiles the rules of the handset.
+func (h *Handset) Compile() error {
+	h.stopped = map[string]bool{}
+
+	for i, rule := range h.Rules {
+		if err := rule.compile(); err != nil {
+			return errors.Wrapf(err, "handset %s: rule %d", h.MSISDN, i)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) compile() (err error) {
+	if r.Match != "" {
+		if r.re, err = regexp.Compile(r.Match); err != nil {
+			return err
+		}
+	}
+
+	if r.Delay != "" {
+		if r.delay, err = time.ParseDuration(r.Delay); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Is returns true if the handset has the given number.
+func (h *Handset) Is(msisdn string) bool {
+	return normalize(h.MSISDN) == normalize(msisdn)
+}
+
+// Answer returns the reply of the handset to the given message, if any.
+// An originator that has been answered with STOP is no longer answered.
+func (h *Handset) Answer(from, text string) (Reply, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	from = normalize(from)
+	if h.stopped[from] {
+		return Reply{}, false
+	}
+
+	for _, rule := range h.Rules {
+		match := []int{0, len(text)}
+		if rule.re != nil {
+			match = rule.re.FindStringSubmatchIndex(text)
+		}
+		if match == nil {
+			continue
+		}
+
+		reply := Reply{Text: rule.Reply, Delay: rule.delay}
+		if rule.re != nil {
+			reply.Text = string(rule.re.ExpandString(nil, rule.Reply, text, match))
+		}
+
+		if rule.Stop {
+			if reply.Text == "" {
+				reply.Text = "STOP"
+			}
+			h.stopped[from] = true
+		}
+
+		return reply, true
+	}
+
+	return Reply{}, false
+}
+
+// Stopped returns true if the given originator has been answered with STOP.
+func (h *Handset) Stopped(from string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.stopped[normalize(from)]
+}
@@ -0,0 +1,54 @@
+package handset_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdouchement/smsc3/handset"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandset_Answer(t *testing.T) {
+	h := &handset.Handset{
+		MSISDN: "+33600000001",
+		Rules: []*handset.Rule{
+			{Match: `(?i)code:? (?P<code>\d+)`, Reply: "${code}", Delay: "2s"},
+			{Match: `(?i)reply yes`, Reply: "YES"},
+			{Match: `(?i)unsubscribe`, Stop: true},
+			{Reply: "Hello"},
+		},
+	}
+	assert.NoError(t, h.Compile())
+	assert.True(t, h.Is("33600000001"))
+
+	reply, ok := h.Answer("BANK", "Your code: 1234")
+	assert.True(t, ok)
+	assert.Equal(t, handset.Reply{Text: "1234", Delay: 2 * time.Second}, reply)
+
+	reply, ok = h.Answer("BANK", "Please reply YES to confirm")
+	assert.True(t, ok)
+	assert.Equal(t, "YES", reply.Text)
+
+	reply, ok = h.Answer("SHOP", "Hi")
+	assert.True(t, ok)
+	assert.Equal(t, "Hello", reply.Text) // Fixed reply
+
+	reply, ok = h.Answer("SHOP", "Send STOP to unsubscribe")
+	assert.True(t, ok)
+	assert.Equal(t, "STOP", reply.Text)
+	assert.True(t, h.Stopped("SHOP"))
+
+	_, ok = h.Answer("SHOP", "Last chance!")
+	assert.False(t, ok) // Opted out
+	assert.False(t, h.Stopped("BANK"))
+}
+
+func TestHandset_Compile(t *testing.T) {
+	assert.Error(t, (&handset.Handset{Rules: []*handset.Rule{{Match: "("}}}).Compile())
+	assert.Error(t, (&handset.Handset{Rules: []*handset.Rule{{Delay: "soon"}}}).Compile())
+
+	h := &handset.Handset{Rules: []*handset.Rule{{Match: "^ping$", Reply: "pong"}}}
+	assert.NoError(t, h.Compile())
+	_, ok := h.Answer("GOPHER", "hello")
+	assert.False(t, ok)
+}
@@ -0,0 +1,167 @@
+package handset
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goburrow/cache"
+	"github.com/mdouchement/smsc3/smpp"
+)
+
+// Limits of the inbox, the simulator may run for a long time under load.
+const (
+	// MaxMessages is the number of messages kept per MSISDN, the oldest ones are dropped.
+	MaxMessages = 100
+	// MaxMailboxes is the number of MSISDNs having a mailbox.
+	MaxMailboxes = 100_000
+	// MailboxTTL is the lifetime of a mailbox that is neither delivered nor read.
+	MailboxTTL = 24 * time.Hour
+)
+
+// Results of a delivery to a handset.
+const (
+	// Stored means that the message has been added to the inbox.
+	Stored Result = "stored"
+	// Replaced means that the message has replaced a stored message (Replace Short Message Type).
+	Replaced Result = "replaced"
+	// Discarded means that the message has been acknowledged but not stored (Short Message Type 0).
+	Discarded Result = "discarded"
+)
+
+type (
+	// A Result is the outcome of a delivery to a handset.
+	Result string
+
+	// A Message is a short message received by a simulated handset.
+	Message struct {
+		ID         string    `json:"id"`
+		From       string    `json:"from"`
+		To         string    `json:"to"`
+		Text       string    `json:"text"`
+		ProtocolID uint8     `json:"protocol_id"`
+		Class      string    `json:"class,omitempty"` // Message class of the data_coding (e.g. "0 (flash)"), see pdutext.MessageClass
+		Received   time.Time `json:"received_at"`
+		Replaced   int       `json:"replaced"`             // Number of times the message has been replaced
+		AfterStop  bool      `json:"after_stop,omitempty"` // Received after the handset has answered STOP to the originator
+	}
+
+	// A Mailbox is the content of the inbox of a handset.
+	Mailbox struct {
+		MSISDN   string    `json:"msisdn"`
+		Messages []Message `json:"messages"`
+		Silent   int       `json:"silent"`  // Number of received silent messages
+		Dropped  int       `json:"dropped"` // Number of old messages dropped, see MaxMessages
+	}
+
+	// An Inbox holds the messages received by the simulated handsets, by MSISDN.
+	Inbox struct {
+		mu        sync.Mutex
+		mailboxes cache.Cache
+	}
+)
+
+// NewInbox returns a new Inbox.
+func NewInbox() *Inbox {
+	return &Inbox{
+		mailboxes: cache.New(
+			cache.WithMaximumSize(MaxMailboxes),
+			cache.WithExpireAfterAccess(MailboxTTL),
+		),
+	}
+}
+
+// Deliver delivers the given message to the handset of its recipient according to its protocol_id.
+// A silent message (Short Message Type 0) is only counted.
+// A Replace Short Message Type replaces the stored message having the same protocol_id and originator, if any.
+func (i *Inbox) Deliver(m Message) Result {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	m.To = normalize(m.To)
+	if m.Received.IsZero() {
+		m.Received = time.Now()
+	}
+
+	mailbox, ok := i.mailbox(m.To)
+	if !ok {
+		mailbox = &Mailbox{MSISDN: m.To}
+		i.mailboxes.Put(m.To, mailbox)
+	}
+
+	if m.ProtocolID == smpp.ProtocolIDSilent {
+		mailbox.Silent++
+		return Discarded
+	}
+
+	if smpp.IsReplaceType(m.ProtocolID) {
+		from := normalize(m.From)
+		for j, stored := range mailbox.Messages {
+			if stored.ProtocolID != m.ProtocolID || normalize(stored.From) != from {
+				continue
+			}
+
+			m.Replaced = stored.Replaced + 1
+			mailbox.Messages[j] = m
+			return Replaced
+		}
+	}
+
+	mailbox.Messages = append(mailbox.Messages, m)
+	if n := len(mailbox.Messages) - MaxMessages; n > 0 {
+		mailbox.Messages = append([]Message(nil), mailbox.Messages[n:]...)
+		mailbox.Dropped += n
+	}
+	return Stored
+}
+
+// Mailbox returns a copy of the inbox of the given MSISDN.
+func (i *Inbox) Mailbox(msisdn string) Mailbox {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	msisdn = normalize(msisdn)
+	mailbox, ok := i.mailbox(msisdn)
+	if !ok {
+		return Mailbox{MSISDN: msisdn, Messages: []Message{}}
+	}
+
+	v := *mailbox
+	v.Messages = append([]Message{}, mailbox.Messages...)
+	return v
+}
+
+// Clear empties the inbox of the given MSISDN.
+func (i *Inbox) Clear(msisdn string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.mailboxes.Invalidate(normalize(msisdn))
+}
+
+// ClearAll empties the inbox of all the MSISDNs.
+func (i *Inbox) ClearAll() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.mailboxes.InvalidateAll()
+}
+
+// Close releases the resources of the inbox.
+func (i *Inbox) Close() error {
+	return i.mailboxes.Close()
+}
+
+func (i *Inbox) mailbox(msisdn string) (*Mailbox, bool) {
+	v, ok := i.mailboxes.GetIfPresent(msisdn)
+	if !ok {
+		return nil, false
+	}
+	return v.(*Mailbox), true
+}
+
+// normalize returns the given number without its international prefix,
+// the ESMEs often omit it in the international addresses (TON 1).
+func normalize(msisdn string) string {
+	return strings.TrimPrefix(strings.TrimSpace(msisdn), "+")
+}
@@ -0,0 +1,62 @@
+package handset_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/mdouchement/smsc3/handset"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInbox(t *testing.T) {
+	inbox := handset.NewInbox()
+
+	assert.Equal(t, handset.Stored, inbox.Deliver(handset.Message{ID: "1", From: "GOPHER", To: "+33600000001", Text: "Hello"}))
+	assert.Equal(t, handset.Discarded, inbox.Deliver(handset.Message{ID: "2", From: "GOPHER", To: "+33600000001", ProtocolID: smpp.ProtocolIDSilent}))
+	assert.Equal(t, handset.Stored, inbox.Deliver(handset.Message{ID: "3", From: "GOPHER", To: "+33600000001", Text: "Balance: 10", ProtocolID: smpp.ProtocolIDReplace1}))
+	assert.Equal(t, handset.Stored, inbox.Deliver(handset.Message{ID: "4", From: "BANK", To: "+33600000001", Text: "Code: 1234", ProtocolID: smpp.ProtocolIDReplace1}))
+	assert.Equal(t, handset.Replaced, inbox.Deliver(handset.Message{ID: "5", From: "GOPHER", To: "33600000001", Text: "Balance: 5", ProtocolID: smpp.ProtocolIDReplace1}))
+	assert.Equal(t, handset.Stored, inbox.Deliver(handset.Message{ID: "6", From: "GOPHER", To: "+33600000001", Text: "Other", ProtocolID: smpp.ProtocolIDReplace2}))
+
+	mailbox := inbox.Mailbox("+33600000001")
+	assert.Equal(t, 1, mailbox.Silent)
+	if assert.Len(t, mailbox.Messages, 4) {
+		assert.Equal(t, "1", mailbox.Messages[0].ID)
+		assert.Equal(t, "5", mailbox.Messages[1].ID) // Replaced in place
+		assert.Equal(t, "Balance: 5", mailbox.Messages[1].Text)
+		assert.Equal(t, 1, mailbox.Messages[1].Replaced)
+		assert.Equal(t, "4", mailbox.Messages[2].ID)
+		assert.Equal(t, "6", mailbox.Messages[3].ID)
+	}
+
+	inbox.Clear("+33600000001")
+	assert.Empty(t, inbox.Mailbox("+33600000001").Messages)
+}
+
+func TestInbox_Limits(t *testing.T) {
+	inbox := handset.NewInbox()
+	defer inbox.Close()
+
+	for i := 0; i < handset.MaxMessages+2; i++ {
+		inbox.Deliver(handset.Message{ID: strconv.Itoa(i), From: "GOPHER", To: "+33600000001", Text: "Hello"})
+	}
+	inbox.Deliver(handset.Message{ID: "other", From: "GOPHER", To: "+33600000002", Text: "Hello"})
+
+	mailbox := inbox.Mailbox("+33600000001")
+	assert.Len(t, mailbox.Messages, handset.MaxMessages)
+	assert.Equal(t, 2, mailbox.Dropped)
+	assert.Equal(t, "2", mailbox.Messages[0].ID) // Oldest ones dropped
+
+	inbox.ClearAll()
+	assert.Empty(t, inbox.Mailbox("+33600000001").Messages)
+	assert.Empty(t, inbox.Mailbox("+33600000002").Messages)
+}
+
+func TestProtocolIDString(t *testing.T) {
+	assert.Equal(t, "silent", smpp.ProtocolIDString(0x40))
+	assert.Equal(t, "replace type 1", smpp.ProtocolIDString(0x41))
+	assert.Equal(t, "replace type 7", smpp.ProtocolIDString(0x47))
+	assert.Equal(t, "", smpp.ProtocolIDString(0x00))
+	assert.False(t, smpp.IsReplaceType(0x48))
+}
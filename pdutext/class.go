@@ -0,0 +1,92 @@
+package pdutext
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Message classes as defined in GSM 03.38 §4.
+const (
+	ClassNone MessageClass = iota // No message class
+	Class0                        // Flash SMS, immediate display
+	Class1                        // ME specific
+	Class2                        // (U)SIM specific
+	Class3                        // TE specific
+)
+
+// A MessageClass is the class of a message carried by the data_coding.
+type MessageClass int
+
+// ParseMessageClass returns the message class of the given name.
+func ParseMessageClass(name string) (MessageClass, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return ClassNone, nil
+	case "0", "flash":
+		return Class0, nil
+	case "1", "me":
+		return Class1, nil
+	case "2", "sim":
+		return Class2, nil
+	case "3", "te":
+		return Class3, nil
+	}
+	return ClassNone, errors.Errorf("unsupported message class: %s", name)
+}
+
+// String returns the name of the message class.
+func (c MessageClass) String() string {
+	switch c {
+	case ClassNone:
+		return "none"
+	case Class0:
+		return "0 (flash)"
+	case Class1:
+		return "1 (ME)"
+	case Class2:
+		return "2 (SIM)"
+	case Class3:
+		return "3 (TE)"
+	}
+	return "unknown"
+}
+
+// Class returns the message class of the given data_coding.
+func Class(coding DataCoding) MessageClass {
+	switch {
+	case coding >= 0x10 && coding < 0x80 && coding&0b0001_0000 != 0:
+		// General data coding and automatic deletion groups with message class
+		return MessageClass(coding&0b0000_0011) + Class0
+	case coding >= 0xF0:
+		// Data coding/message class group
+		return MessageClass(coding&0b0000_0011) + Class0
+	}
+	return ClassNone
+}
+
+// ClassCoding returns the data_coding of the given codec carrying the given message class
+// (GSM 03.38 general data coding group).
+// Only GSM 7-bit, 8-bit binary and UCS2 codings can carry a message class.
+func ClassCoding(c Codec, class MessageClass) (DataCoding, error) {
+	if class == ClassNone {
+		return c.Type(), nil
+	}
+	if class < Class0 || class > Class3 {
+		return c.Type(), errors.Errorf("unsupported message class: %d", class)
+	}
+
+	var coding DataCoding
+	switch c.(type) {
+	case GSM7, GSM7Packed, GSM7National:
+		coding = 0b0001_0000
+	case Binary:
+		coding = 0b0001_0100
+	case UCS2:
+		coding = 0b0001_1000
+	default:
+		return c.Type(), errors.Errorf("message class is not supported with data_coding 0x%02X", c.Type())
+	}
+
+	return coding | DataCoding(class-Class0), nil
+}
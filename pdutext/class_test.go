@@ -0,0 +1,61 @@
+package pdutext_test
+
+import (
+	"testing"
+
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassCoding(t *testing.T) {
+	tests := []struct {
+		codec  pdutext.Codec
+		class  pdutext.MessageClass
+		coding pdutext.DataCoding
+	}{
+		{codec: pdutext.GSM7("hi"), class: pdutext.ClassNone, coding: 0x00},
+		{codec: pdutext.GSM7("hi"), class: pdutext.Class0, coding: 0x10},
+		{codec: pdutext.GSM7Packed("hi"), class: pdutext.Class2, coding: 0x12},
+		{codec: pdutext.Binary{0x01}, class: pdutext.Class1, coding: 0x15},
+		{codec: pdutext.UCS2("バカ"), class: pdutext.Class3, coding: 0x1B},
+		{codec: pdutext.Latin1("hé"), class: pdutext.ClassNone, coding: 0x03},
+	}
+
+	for _, test := range tests {
+		coding, err := pdutext.ClassCoding(test.codec, test.class)
+		assert.NoError(t, err)
+		assert.Equal(t, test.coding, coding)
+		assert.Equal(t, test.class, pdutext.Class(coding))
+		assert.Equal(t, alphabet(test.codec), pdutext.Alphabet(coding))
+	}
+
+	_, err := pdutext.ClassCoding(pdutext.Latin1("hé"), pdutext.Class0)
+	assert.Error(t, err)
+}
+
+func TestClass(t *testing.T) {
+	assert.Equal(t, pdutext.ClassNone, pdutext.Class(0x08))
+	assert.Equal(t, pdutext.ClassNone, pdutext.Class(0x00))
+	assert.Equal(t, pdutext.ClassNone, pdutext.Class(0x04))
+	assert.Equal(t, pdutext.Class0, pdutext.Class(0xF0))
+	assert.Equal(t, pdutext.Class2, pdutext.Class(0xF6))
+	assert.Equal(t, pdutext.Class1, pdutext.Class(0x51))
+	assert.Equal(t, pdutext.ClassNone, pdutext.Class(0xC8))
+}
+
+func TestParseMessageClass(t *testing.T) {
+	class, err := pdutext.ParseMessageClass("flash")
+	assert.NoError(t, err)
+	assert.Equal(t, pdutext.Class0, class)
+
+	class, err = pdutext.ParseMessageClass("2")
+	assert.NoError(t, err)
+	assert.Equal(t, pdutext.Class2, class)
+
+	_, err = pdutext.ParseMessageClass("4")
+	assert.Error(t, err)
+}
+
+func alphabet(c pdutext.Codec) pdutext.DataCoding {
+	return pdutext.Alphabet(c.Type())
+}
@@ -0,0 +1,142 @@
+package pdutext
+
+import (
+	"encoding/hex"
+)
+
+// Data coding values not defined as codecs.
+const (
+	IA5Type     DataCoding = 0x01 // IA5 (CCITT T.50)/ASCII (ANSI X3.4)
+	BinaryType  DataCoding = 0x02 // Octet unspecified (8-bit binary)
+	Binary2Type DataCoding = 0x04 // Octet unspecified (8-bit binary)
+)
+
+// Alphabets of the SMSC default data_coding (0).
+const (
+	// DefaultGSM7 is GSM 7-bit coding (unpacked).
+	DefaultGSM7 DefaultAlphabet = iota
+	// DefaultGSM7Packed is GSM 7-bit coding (packed).
+	DefaultGSM7Packed
+	// DefaultISO88591 is ISO-8859-1 coding.
+	DefaultISO88591
+)
+
+// A DefaultAlphabet tells how texts using the SMSC default data_coding (0) are coded.
+type DefaultAlphabet int
+
+// Alphabet returns the alphabet (DefaultType, BinaryType, UCS2Type, etc.) of the given data_coding.
+// The GSM 03.38 data coding groups (0x10 and above) are reduced to their alphabet.
+func Alphabet(coding DataCoding) DataCoding {
+	switch {
+	case coding < 0x10:
+		// SMPP 3.4 values
+		return coding
+	case coding < 0x80:
+		// General data coding and automatic deletion groups (GSM 03.38 §4)
+		switch coding & 0b0000_1100 {
+		case 0b0000_0000:
+			return DefaultType
+		case 0b0000_0100:
+			return Binary2Type
+		case 0b0000_1000:
+			return UCS2Type
+		}
+	case coding < 0xC0:
+		// Reserved coding groups
+	case coding < 0xE0:
+		// Message waiting indication group (GSM 7-bit)
+		return DefaultType
+	case coding < 0xF0:
+		// Message waiting indication group (UCS2)
+		return UCS2Type
+	default:
+		// Data coding/message class group
+		if coding&0b0000_0100 != 0 {
+			return Binary2Type
+		}
+		return DefaultType
+	}
+
+	return BinaryType
+}
+
+// Decode decodes the given short message payload according to its data_coding.
+// Binary payloads are returned in hexadecimal.
+func Decode(coding DataCoding, p []byte) string {
+	switch Alphabet(coding) {
+	case DefaultType:
+		return string(GSM7(p).Decode())
+	case IA5Type:
+		return string(p)
+	case Latin1Type:
+		return string(Latin1(p).Decode())
+	case ISO88595Type:
+		return string(ISO88595(p).Decode())
+	case ISO88598Type:
+		return string(ISO88598(p).Decode())
+	case UCS2Type:
+		return string(UCS2(p).Decode())
+	default:
+		return hex.EncodeToString(p)
+	}
+}
+
+// DecodeShortMessage decodes the given short message according to its data_coding.
+// When udhi is set, the UDH is stripped and its national language shift tables are honoured.
+// The alphabet tells how the SMSC default data_coding is coded.
+func DecodeShortMessage(coding DataCoding, sm []byte, udhi bool, alphabet DefaultAlphabet) (string, error) {
+	var udh UDH
+	if udhi {
+		var err error
+		if udh, err = ParseUDH(sm); err != nil {
+			return Decode(BinaryType, sm), err
+		}
+	}
+
+	payload := sm[udh.Len():]
+	if Alphabet(coding) != DefaultType {
+		return Decode(coding, payload), nil
+	}
+
+	switch {
+	case alphabet == DefaultISO88591 && coding == DefaultType:
+		return string(DefaultLatin1(payload).Decode()), nil
+	case alphabet == DefaultGSM7Packed:
+		payload = UnpackWithUDH(payload, udh.Len())
+	}
+	return udh.Charset().Decode(payload), nil
+}
+
+// Recode adapts the given short message using the SMSC default alphabet to another account's alphabet, see DecodeShortMessage.
+// The UDH, including its national language shift tables, is kept.
+func Recode(coding DataCoding, sm []byte, udhi bool, from, to DefaultAlphabet) ([]byte, error) {
+	if Alphabet(coding) != DefaultType || from == to {
+		return sm, nil
+	}
+
+	var udh UDH
+	if udhi {
+		var err error
+		if udh, err = ParseUDH(sm); err != nil {
+			return sm, err
+		}
+	}
+
+	text, err := DecodeShortMessage(coding, sm, udhi, from)
+	if err != nil {
+		return sm, err
+	}
+
+	var c Codec
+	switch cs := udh.Charset(); {
+	case to == DefaultISO88591 && coding == DefaultType:
+		c = DefaultLatin1(text)
+	case !cs.IsDefault():
+		c = GSM7National{Text: []byte(text), Charset: cs, Packed: to == DefaultGSM7Packed}
+	case to == DefaultGSM7Packed:
+		c = GSM7Packed(text)
+	default:
+		c = GSM7(text)
+	}
+	return EncodeUserData(udh.Bytes(), c), nil
+}
@@ -0,0 +1,134 @@
+package pdutext_test
+
+import (
+	"testing"
+
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlphabet(t *testing.T) {
+	tests := map[pdutext.DataCoding]pdutext.DataCoding{
+		0x00: pdutext.DefaultType,
+		0x03: 0x03,
+		0x08: pdutext.UCS2Type,
+		0x10: pdutext.DefaultType, // Class 0
+		0x18: pdutext.UCS2Type,    // Class 0
+		0x15: pdutext.Binary2Type, // Class 1
+		0xC8: pdutext.DefaultType, // MWI discard
+		0xE8: pdutext.UCS2Type,    // MWI store
+		0xF0: pdutext.DefaultType, // Class 0
+		0xF6: pdutext.Binary2Type, // Class 2
+		0x90: pdutext.BinaryType,  // Reserved
+	}
+
+	for coding, expected := range tests {
+		assert.Equal(t, expected, pdutext.Alphabet(coding), "0x%02X", coding)
+	}
+}
+
+func TestDecodeShortMessage(t *testing.T) {
+	udh := []byte{5, 0, 3, 42, 2, 1}
+
+	tests := []struct {
+		name     string
+		coding   pdutext.DataCoding
+		sm       []byte
+		udhi     bool
+		alphabet pdutext.DefaultAlphabet
+		expected string
+	}{
+		{
+			name:     "gsm7",
+			coding:   0x00,
+			sm:       pdutext.GSM7("Hello {world}").Encode(),
+			expected: "Hello {world}",
+		},
+		{
+			name:     "gsm7 packed with UDH",
+			coding:   0x00,
+			sm:       pdutext.EncodeUserData(udh, pdutext.GSM7Packed("Hello ¡")),
+			udhi:     true,
+			alphabet: pdutext.DefaultGSM7Packed,
+			expected: "Hello ¡",
+		},
+		{
+			name:     "gsm7 packed with empty UDH",
+			coding:   0x00,
+			sm:       pdutext.EncodeUserData([]byte{0}, pdutext.GSM7Packed("Hello")),
+			udhi:     true,
+			alphabet: pdutext.DefaultGSM7Packed,
+			expected: "Hello",
+		},
+		{
+			name:     "latin1",
+			coding:   0x03,
+			sm:       []byte{'c', 0xE9, 'd', 0xE9},
+			expected: "cédé",
+		},
+		{
+			name:     "ucs2 with UDH",
+			coding:   0x08,
+			sm:       pdutext.EncodeUserData(udh, pdutext.UCS2("バカ")),
+			udhi:     true,
+			expected: "バカ",
+		},
+		{
+			name:     "ucs2 class 1",
+			coding:   0x19,
+			sm:       pdutext.UCS2("バカ").Encode(),
+			expected: "バカ",
+		},
+		{
+			name:     "smsc default as latin1",
+			coding:   0x00,
+			sm:       []byte{'c', 0xE9, 'd', 0xE9},
+			alphabet: pdutext.DefaultISO88591,
+			expected: "cédé",
+		},
+		{
+			name:     "hebrew",
+			coding:   0x07,
+			sm:       pdutext.ISO88598("שלום").Encode(),
+			expected: "שלום",
+		},
+		{
+			name:     "cyrillic",
+			coding:   0x06,
+			sm:       pdutext.ISO88595("Привет").Encode(),
+			expected: "Привет",
+		},
+		{
+			name:     "binary",
+			coding:   0x04,
+			sm:       []byte{0xCA, 0xFE},
+			expected: "cafe",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			text, err := pdutext.DecodeShortMessage(test.coding, test.sm, test.udhi, test.alphabet)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, text)
+		})
+	}
+}
+
+func TestRecode(t *testing.T) {
+	udh := []byte{5, 0, 3, 42, 2, 1}
+	sm := pdutext.EncodeUserData(udh, pdutext.GSM7("Hello {world}"))
+
+	packed, err := pdutext.Recode(pdutext.DefaultType, sm, true, pdutext.DefaultGSM7, pdutext.DefaultGSM7Packed)
+	assert.NoError(t, err)
+	assert.Equal(t, pdutext.EncodeUserData(udh, pdutext.GSM7Packed("Hello {world}")), packed)
+
+	same, err := pdutext.Recode(pdutext.DefaultType, sm, true, pdutext.DefaultGSM7, pdutext.DefaultGSM7)
+	assert.NoError(t, err)
+	assert.Equal(t, sm, same)
+
+	binary := []byte{0xCA, 0xFE}
+	same, err = pdutext.Recode(pdutext.Binary2Type, binary, false, pdutext.DefaultGSM7, pdutext.DefaultGSM7Packed)
+	assert.NoError(t, err)
+	assert.Equal(t, binary, same)
+}
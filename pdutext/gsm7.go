@@ -1,5 +1,7 @@
 package pdutext
 
+import "strings"
+
 // IsGSM7 returns true if the given string complies with GSM7 table.
 func IsGSM7(message string) bool {
 	i, ns := 0, len(message)
@@ -134,6 +136,22 @@ func IsGSM7(message string) bool {
 	return true
 }
 
+// ReplaceNonGSM7 returns the given string whose characters not complying with GSM7 table are replaced by the given one.
+func ReplaceNonGSM7(message string, replacement rune) string {
+	if IsGSM7(message) {
+		return message
+	}
+
+	var b strings.Builder
+	for _, r := range message {
+		if !IsGSM7(string(r)) {
+			r = replacement
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 // GSM7size computes the message's length based on the GSM 03.38 table from the given UTF-8 string.
 func GSM7size(message string) (size int) {
 	i, ns := 0, len(message)
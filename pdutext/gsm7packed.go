@@ -0,0 +1,127 @@
+package pdutext
+
+import (
+	"bytes"
+
+	"github.com/mdouchement/smpp/smpp/pdu/pdutext"
+)
+
+// CR is the septet used to pad the last octet of a packed message when 7 bits are spare (3GPP 23.038 §6.1.2.3.1).
+const CR = 0x0D
+
+// GSM7Packed is GSM 7-bit coding (packed).
+// This coding allows 160 characters coded over 140 bytes (160 * 7-bit / 8-bit = 140 bytes)
+// which is the format described in GSM 03.38.
+type GSM7Packed []byte
+
+// Type implements the Codec interface.
+func (s GSM7Packed) Type() DataCoding {
+	return DefaultType
+}
+
+// Encode to GSM 7-bit (packed).
+func (s GSM7Packed) Encode() []byte {
+	return s.EncodeWithUDH(0)
+}
+
+// Decode from GSM 7-bit (packed).
+func (s GSM7Packed) Decode() []byte {
+	return s.DecodeWithUDH(0)
+}
+
+// EncodeWithUDH encodes the text so it can be appended to a UDH of n bytes (UDHL included).
+// The first septet is aligned on a septet boundary thanks to fill bits.
+func (s GSM7Packed) EncodeWithUDH(n int) []byte {
+	return pack(pdutext.GSM7(s).Encode(), n)
+}
+
+// DecodeWithUDH decodes the text that follows a UDH of n bytes (UDHL included).
+func (s GSM7Packed) DecodeWithUDH(n int) []byte {
+	return pdutext.GSM7(UnpackWithUDH(s, n)).Decode()
+}
+
+// pack packs the septets after a UDH of n bytes.
+func pack(septets []byte, n int) []byte {
+	fill := FillBits(n)
+	if (fill+7*len(septets))%8 == 1 {
+		// The last octet has 7 spare bits, they would be decoded as '@'.
+		septets = append(septets, CR)
+	}
+
+	return Pack(septets, fill)
+}
+
+// UnpackWithUDH unpacks the septets that follow a UDH of n bytes (UDHL included).
+// The CR padding the last octet when it has 7 spare bits is removed (3GPP 23.038 §6.1.2.3.1).
+func UnpackWithUDH(p []byte, n int) []byte {
+	fill := FillBits(n)
+
+	septets := Unpack(p, fill)
+	if (fill+7*len(septets))%8 == 0 && bytes.HasSuffix(septets, []byte{CR}) {
+		septets = septets[:len(septets)-1] // Padding
+	}
+	return septets
+}
+
+// FillBits returns the number of bits needed after a UDH of n bytes (UDHL included)
+// to start the text on a septet boundary.
+func FillBits(n int) int {
+	return (7 - (n*8)%7) % 7
+}
+
+// Pack packs the given septets after the given number of fill bits.
+func Pack(septets []byte, fill int) []byte {
+	p := make([]byte, (fill+7*len(septets)+7)/8)
+
+	bit := fill
+	for _, septet := range septets {
+		septet &= 0x7F
+		i, offset := bit/8, bit%8
+
+		p[i] |= septet << offset
+		if offset > 1 {
+			p[i+1] |= septet >> (8 - offset)
+		}
+
+		bit += 7
+	}
+
+	return p
+}
+
+// Unpack unpacks the septets stored after the given number of fill bits.
+func Unpack(p []byte, fill int) []byte {
+	n := (len(p)*8 - fill) / 7
+	if n <= 0 {
+		return nil
+	}
+	septets := make([]byte, n)
+
+	bit := fill
+	for k := range septets {
+		i, offset := bit/8, bit%8
+
+		septet := p[i] >> offset
+		if offset > 1 && i+1 < len(p) {
+			septet |= p[i+1] << (8 - offset)
+		}
+		septets[k] = septet & 0x7F
+
+		bit += 7
+	}
+
+	return septets
+}
+
+// EncodeUserData returns the user data made of the given UDH followed by the encoded text.
+func EncodeUserData(udh []byte, c Codec) []byte {
+	ud := append([]byte(nil), udh...)
+
+	switch v := c.(type) {
+	case GSM7Packed:
+		return append(ud, v.EncodeWithUDH(len(udh))...)
+	case GSM7National:
+		return append(ud, v.EncodeWithUDH(len(udh))...)
+	}
+	return append(ud, c.Encode()...)
+}
@@ -0,0 +1,55 @@
+package pdutext_test
+
+import (
+	"testing"
+
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGSM7Packed(t *testing.T) {
+	tests := []struct {
+		text   string
+		packed []byte
+	}{
+		{
+			text:   "hellohello",
+			packed: []byte{0xE8, 0x32, 0x9B, 0xFD, 0x46, 0x97, 0xD9, 0xEC, 0x37},
+		},
+		{
+			text:   "1234567",
+			packed: []byte{0x31, 0xD9, 0x8C, 0x56, 0xB3, 0xDD, 0x1A}, // CR padding
+		},
+		{
+			text:   "[€]",
+			packed: []byte{0x1B, 0xDE, 0xA6, 0xBC, 0xF1, 0x01},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			assert.Equal(t, test.packed, pdutext.GSM7Packed(test.text).Encode())
+			assert.Equal(t, test.text, string(pdutext.GSM7Packed(test.packed).Decode()))
+		})
+	}
+}
+
+func TestGSM7Packed_UDH(t *testing.T) {
+	udh := []byte{5, 0, 3, 42, 2, 1}
+	assert.Equal(t, 1, pdutext.FillBits(len(udh)))
+	assert.Equal(t, 0, pdutext.FillBits(7))
+
+	ud := pdutext.EncodeUserData(udh, pdutext.GSM7Packed("hellohello"))
+	assert.Equal(t, udh, ud[:len(udh)])
+	assert.Equal(t, []byte{0xD0, 0x65, 0x36, 0xFB, 0x8D, 0x2E, 0xB3, 0xD9, 0x6F}, ud[len(udh):])
+	assert.Equal(t, "hellohello", string(pdutext.GSM7Packed(ud[len(udh):]).DecodeWithUDH(len(udh))))
+
+	// 153 septets fill the 134 remaining octets.
+	text := make([]byte, pdutext.SizeGSM7Multipart)
+	for i := range text {
+		text[i] = 'a'
+	}
+	ud = pdutext.EncodeUserData(udh, pdutext.GSM7Packed(text))
+	assert.Len(t, ud, 140)
+	assert.Equal(t, string(text), string(pdutext.GSM7Packed(ud[len(udh):]).DecodeWithUDH(len(udh))))
+}
@@ -0,0 +1,125 @@
+package pdutext
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A MessageWaiting is a message waiting indication (e.g. voicemail waiting).
+// It is carried by the data_coding (GSM 03.38 §4 message waiting indication groups),
+// by the ms_msg_wait_facilities TLV or by the UDH Special SMS Message Indication IE.
+type MessageWaiting struct {
+	Type   byte // IndicationVoicemail, IndicationFax, IndicationEmail or IndicationOther
+	Active bool
+	Store  bool // Store the message, discarded otherwise
+	Count  int  // Number of waiting messages, only carried by the UDH
+}
+
+// ParseIndicationType returns the indication type of the given name.
+func ParseIndicationType(name string) (byte, error) {
+	switch strings.ToLower(name) {
+	case "", "voicemail":
+		return IndicationVoicemail, nil
+	case "fax":
+		return IndicationFax, nil
+	case "email":
+		return IndicationEmail, nil
+	case "other":
+		return IndicationOther, nil
+	}
+	return 0, errors.Errorf("unsupported indication type: %s", name)
+}
+
+// ParseMessageWaiting returns the message waiting indication of the given data_coding.
+// It returns false if the data_coding is not in a message waiting indication group.
+func ParseMessageWaiting(coding DataCoding) (MessageWaiting, bool) {
+	if coding < 0xC0 || coding >= 0xF0 {
+		return MessageWaiting{}, false
+	}
+
+	return MessageWaiting{
+		Type:   byte(coding & 0b0000_0011),
+		Active: coding&0b0000_1000 != 0,
+		Store:  coding >= 0xD0,
+	}, true
+}
+
+// ParseFacilities returns the message waiting indication of the given ms_msg_wait_facilities TLV value.
+func ParseFacilities(b byte) MessageWaiting {
+	return MessageWaiting{
+		Type:   b & 0b0000_0011,
+		Active: b&0b1000_0000 != 0,
+	}
+}
+
+// MessageWaiting returns the message waiting indication of the IE.
+func (ie SpecialSMSIndication) MessageWaiting() MessageWaiting {
+	return MessageWaiting{
+		Type:   ie.Type & 0b0000_0011,
+		Active: ie.Count > 0,
+		Store:  ie.Store,
+		Count:  ie.Count,
+	}
+}
+
+// IE returns the UDH Special SMS Message Indication IE of the indication.
+func (mw MessageWaiting) IE() SpecialSMSIndication {
+	return SpecialSMSIndication{
+		Store: mw.Store,
+		Type:  mw.Type & 0b0000_0011,
+		Count: mw.Count,
+	}
+}
+
+// Facilities returns the ms_msg_wait_facilities TLV value of the indication.
+func (mw MessageWaiting) Facilities() byte {
+	b := mw.Type & 0b0000_0011
+	if mw.Active {
+		b |= 0b1000_0000
+	}
+	return b
+}
+
+// Coding returns the data_coding of the given codec carrying the indication.
+// Discarded messages are GSM 7-bit, stored messages are GSM 7-bit or UCS2.
+func (mw MessageWaiting) Coding(c Codec) (DataCoding, error) {
+	coding := DataCoding(mw.Type & 0b0000_0011)
+	if mw.Active {
+		coding |= 0b0000_1000
+	}
+
+	switch c.(type) {
+	case GSM7, GSM7Packed, GSM7National:
+		if mw.Store {
+			return 0xD0 | coding, nil
+		}
+		return 0xC0 | coding, nil
+	case UCS2:
+		if mw.Store {
+			return 0xE0 | coding, nil
+		}
+	}
+
+	return c.Type(), errors.Errorf("message waiting indication is not supported with data_coding 0x%02X", c.Type())
+}
+
+// String returns a human-readable description of the indication.
+func (mw MessageWaiting) String() string {
+	var types = []string{"voicemail", "fax", "email", "other"}
+
+	state := "inactive"
+	if mw.Active {
+		state = "active"
+	}
+	if mw.Count > 0 {
+		state = fmt.Sprintf("%d waiting", mw.Count)
+	}
+
+	if mw.Store {
+		state += " (store)"
+	}
+
+	return fmt.Sprintf("%s %s", types[mw.Type&0b0000_0011], state)
+}
@@ -0,0 +1,53 @@
+package pdutext_test
+
+import (
+	"testing"
+
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageWaiting_Coding(t *testing.T) {
+	tests := []struct {
+		codec  pdutext.Codec
+		mw     pdutext.MessageWaiting
+		coding pdutext.DataCoding
+	}{
+		{codec: pdutext.GSM7("x"), mw: pdutext.MessageWaiting{Active: true}, coding: 0xC8},
+		{codec: pdutext.GSM7("x"), mw: pdutext.MessageWaiting{}, coding: 0xC0},
+		{codec: pdutext.GSM7Packed("x"), mw: pdutext.MessageWaiting{Type: pdutext.IndicationFax, Active: true, Store: true}, coding: 0xD9},
+		{codec: pdutext.UCS2("バカ"), mw: pdutext.MessageWaiting{Type: pdutext.IndicationEmail, Active: true, Store: true}, coding: 0xEA},
+	}
+
+	for _, test := range tests {
+		coding, err := test.mw.Coding(test.codec)
+		assert.NoError(t, err)
+		assert.Equal(t, test.coding, coding)
+
+		mw, ok := pdutext.ParseMessageWaiting(coding)
+		assert.True(t, ok)
+		assert.Equal(t, test.mw, mw)
+	}
+
+	_, err := pdutext.MessageWaiting{}.Coding(pdutext.UCS2("バカ"))
+	assert.Error(t, err) // UCS2 must be stored
+
+	_, err = pdutext.MessageWaiting{Store: true}.Coding(pdutext.Latin1("é"))
+	assert.Error(t, err)
+
+	_, ok := pdutext.ParseMessageWaiting(0xF0)
+	assert.False(t, ok)
+}
+
+func TestMessageWaiting_Facilities(t *testing.T) {
+	mw := pdutext.MessageWaiting{Type: pdutext.IndicationOther, Active: true}
+	assert.Equal(t, byte(0x83), mw.Facilities())
+	assert.Equal(t, mw, pdutext.ParseFacilities(0x83))
+}
+
+func TestMessageWaiting_IE(t *testing.T) {
+	mw := pdutext.MessageWaiting{Type: pdutext.IndicationVoicemail, Active: true, Store: true, Count: 3}
+	assert.Equal(t, []byte{0x80, 3}, mw.IE().Data())
+	assert.Equal(t, mw, mw.IE().MessageWaiting())
+	assert.Equal(t, "voicemail 3 waiting (store)", mw.String())
+}
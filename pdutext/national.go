@@ -0,0 +1,404 @@
+package pdutext
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// National language identifiers as defined in 3GPP 23.038 §6.2.1.2.4.
+// They are used in the UDH national language single shift (0x24) and locking shift (0x25) IEs.
+const (
+	Default    Language = 0
+	Turkish    Language = 1
+	Spanish    Language = 2
+	Portuguese Language = 3
+)
+
+// Indic languages of 3GPP 23.038 Annex A.2/A.3. Their shift tables are not implemented:
+// they are only named in the logs, the received texts are decoded with the default alphabet
+// and the sent texts use UCS2.
+const (
+	Bengali   Language = 4
+	Gujarati  Language = 5
+	Hindi     Language = 6
+	Kannada   Language = 7
+	Malayalam Language = 8
+	Oriya     Language = 9
+	Punjabi   Language = 10
+	Tamil     Language = 11
+	Telugu    Language = 12
+	Urdu      Language = 13
+)
+
+const escape = 0x1B
+
+type (
+	// A Language identifies a GSM 7-bit national language table.
+	Language int
+
+	// A Charset is a GSM 7-bit alphabet made of a locking shift table and a single shift table.
+	Charset struct {
+		Locking Language
+		Single  Language
+	}
+
+	// GSM7National is GSM 7-bit coding (unpacked or packed) using national language shift tables.
+	// The UDH must contain the IEs returned by Charset.IEs.
+	GSM7National struct {
+		Text    []byte
+		Charset Charset
+		Packed  bool
+	}
+)
+
+// 3GPP 23.038 §6.2.1 and Annex A.
+var (
+	lockings = map[Language][]rune{
+		Default: []rune("@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+			"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"),
+		Turkish: []rune("@£$¥€éùıòÇ\nĞğ\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bŞşßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+			"İABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§çabcdefghijklmnopqrstuvwxyzäöñüà"),
+		Portuguese: []rune("@£$¥êéúíóç\nÔô\rÁáΔ_ªÇÀ∞^\\€Ó|\x1bÂâÊÉ !\"#º%&'()*+,-./0123456789:;<=>?" +
+			"ÍABCDEFGHIJKLMNOPQRSTUVWXYZÃÕÚÜ§~abcdefghijklmnopqrstuvwxyzãõ`üà"),
+	}
+
+	singles = map[Language]map[byte]rune{
+		Default: {
+			0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2F: '\\', 0x3C: '[', 0x3D: '~', 0x3E: ']', 0x40: '|', 0x65: '€',
+		},
+		Turkish: {
+			0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2F: '\\', 0x3C: '[', 0x3D: '~', 0x3E: ']', 0x40: '|', 0x65: '€',
+			0x47: 'Ğ', 0x49: 'İ', 0x53: 'Ş', 0x63: 'ç', 0x67: 'ğ', 0x69: 'ı', 0x73: 'ş',
+		},
+		Spanish: {
+			0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2F: '\\', 0x3C: '[', 0x3D: '~', 0x3E: ']', 0x40: '|', 0x65: '€',
+			0x09: 'ç', 0x41: 'Á', 0x49: 'Í', 0x4F: 'Ó', 0x55: 'Ú', 0x61: 'á', 0x69: 'í', 0x6F: 'ó', 0x75: 'ú',
+		},
+		Portuguese: {
+			0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2F: '\\', 0x3C: '[', 0x3D: '~', 0x3E: ']', 0x40: '|', 0x65: '€',
+			0x05: 'ê', 0x09: 'ç', 0x0B: 'Ô', 0x0C: 'ô', 0x0E: 'Á', 0x0F: 'á', 0x12: 'Φ', 0x13: 'Γ', 0x15: 'Ω', 0x16: 'Π',
+			0x17: 'Ψ', 0x18: 'Σ', 0x19: 'Θ', 0x1F: 'Ê', 0x41: 'À', 0x49: 'Í', 0x4F: 'Ó', 0x55: 'Ú', 0x5B: 'Ã', 0x5C: 'Õ',
+			0x61: 'Â', 0x69: 'í', 0x6F: 'ó', 0x75: 'ú', 0x7B: 'ã', 0x7C: 'õ', 0x7F: 'â',
+		},
+	}
+)
+
+// ParseLanguage returns the language of the given name.
+func ParseLanguage(name string) (Language, error) {
+	switch strings.ToLower(name) {
+	case "", "default":
+		return Default, nil
+	case "turkish", "tr":
+		return Turkish, nil
+	case "spanish", "es":
+		return Spanish, nil
+	case "portuguese", "pt":
+		return Portuguese, nil
+	}
+
+	for l := Bengali; l <= Urdu; l++ {
+		if strings.EqualFold(name, l.String()) {
+			return Default, errors.Errorf("unsupported national language: %s, the Indic shift tables are not implemented", name)
+		}
+	}
+	return Default, errors.Errorf("unsupported national language: %s", name)
+}
+
+// String returns the name of the language.
+func (l Language) String() string {
+	switch l {
+	case Default:
+		return "default"
+	case Turkish:
+		return "turkish"
+	case Spanish:
+		return "spanish"
+	case Portuguese:
+		return "portuguese"
+	case Bengali:
+		return "bengali"
+	case Gujarati:
+		return "gujarati"
+	case Hindi:
+		return "hindi"
+	case Kannada:
+		return "kannada"
+	case Malayalam:
+		return "malayalam"
+	case Oriya:
+		return "oriya"
+	case Punjabi:
+		return "punjabi"
+	case Tamil:
+		return "tamil"
+	case Telugu:
+		return "telugu"
+	case Urdu:
+		return "urdu"
+	}
+	return "unknown"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (l Language) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (l *Language) UnmarshalText(b []byte) (err error) {
+	*l, err = ParseLanguage(string(b))
+	return err
+}
+
+// SelectCharset returns the charset, among the given languages, that encodes the message with the fewest segments.
+// The GSM 03.38 default alphabet is always a candidate.
+// It returns false if the message cannot be encoded with any of them.
+func SelectCharset(message string, languages ...Language) (Charset, bool) {
+	candidates := []Language{Default}
+	for _, l := range languages {
+		if l != Default {
+			candidates = append(candidates, l)
+		}
+	}
+
+	var selected Charset
+	var segments, size int
+	for _, locking := range candidates {
+		if _, ok := lockings[locking]; !ok {
+			continue
+		}
+
+		for _, single := range candidates {
+			if _, ok := singles[single]; !ok {
+				continue
+			}
+
+			cs := Charset{Locking: locking, Single: single}
+			if !cs.Is(message) {
+				continue
+			}
+
+			// Fewest segments, then smallest UDH, then fewest septets.
+			n, l := cs.Segments(message), cs.Size(message)
+			switch {
+			case segments == 0, n < segments:
+			case n == segments && len(cs.IEs()) < len(selected.IEs()):
+			case n == segments && len(cs.IEs()) == len(selected.IEs()) && l < size:
+			default:
+				continue
+			}
+			selected, segments, size = cs, n, l
+		}
+	}
+
+	return selected, segments > 0
+}
+
+// IsDefault returns true if the charset is the GSM 03.38 default alphabet.
+func (cs Charset) IsDefault() bool {
+	return cs.Locking == Default && cs.Single == Default
+}
+
+// IEs returns the UDH information elements that announce the charset.
+func (cs Charset) IEs() []IE {
+	var ies []IE
+	if cs.Locking != Default {
+		ies = append(ies, LockingShift(cs.Locking))
+	}
+	if cs.Single != Default {
+		ies = append(ies, SingleShift(cs.Single))
+	}
+	return ies
+}
+
+// Limits returns the max number of septets in a single SMS and in each segment of a multipart SMS.
+func (cs Charset) Limits() (single int, multipart int) {
+	udh := UDH{IEs: cs.IEs()}
+	single = (140 - udh.Len()) * 8 / 7
+
+	udh.Add(Concatenation{})
+	multipart = (140 - udh.Len()) * 8 / 7
+	return single, multipart
+}
+
+// Is returns true if the message can be encoded with the charset.
+func (cs Charset) Is(message string) bool {
+	for _, r := range message {
+		if cs.runeSize(r) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Size returns the number of septets used to encode the message.
+func (cs Charset) Size(message string) (size int) {
+	for _, r := range message {
+		size += cs.runeSize(r)
+	}
+	return size
+}
+
+// Segments returns the number of segments used to send the given message.
+func (cs Charset) Segments(message string) int {
+	single, multipart := cs.Limits()
+	if cs.Size(message) <= single {
+		return 1
+	}
+	return len(cs.Split(message, multipart))
+}
+
+// Split splits the message in segments of at most the given number of septets.
+// An escape sequence is never split.
+func (cs Charset) Split(message string, size int) []string {
+	var segments []string
+	var segment strings.Builder
+	var s int
+
+	for _, r := range message {
+		n := cs.runeSize(r)
+		if s+n > size {
+			segments = append(segments, segment.String())
+			segment.Reset()
+			s = 0
+		}
+
+		segment.WriteRune(r)
+		s += n
+	}
+
+	if segment.Len() > 0 {
+		segments = append(segments, segment.String())
+	}
+
+	return segments
+}
+
+// Encode encodes the message in unpacked septets.
+// The characters that are not in the charset are replaced by '?' and reported by the error.
+func (cs Charset) Encode(message string) ([]byte, error) {
+	septets := make([]byte, 0, len(message))
+	var err error
+
+next:
+	for _, r := range message {
+		for i, v := range cs.locking() {
+			if v == r && i != escape {
+				septets = append(septets, byte(i))
+				continue next
+			}
+		}
+
+		for k, v := range cs.single() {
+			if v == r {
+				septets = append(septets, escape, k)
+				continue next
+			}
+		}
+
+		if err == nil {
+			err = errors.Errorf("invalid character for charset %s/%s: %q", cs.Locking, cs.Single, r)
+		}
+		septets = append(septets, '?')
+	}
+
+	return septets, err
+}
+
+// Decode decodes the given unpacked septets.
+func (cs Charset) Decode(septets []byte) string {
+	var b strings.Builder
+	locking, single := cs.locking(), cs.single()
+
+	for i := 0; i < len(septets); i++ {
+		septet := septets[i] & 0x7F
+		if septet != escape {
+			b.WriteRune(locking[septet])
+			continue
+		}
+
+		if i+1 == len(septets) {
+			break
+		}
+		i++
+
+		if r, ok := single[septets[i]&0x7F]; ok {
+			b.WriteRune(r)
+			continue
+		}
+		// 3GPP 23.038 §6.2.1.1: the receiving entity displays the character of the locking shift table.
+		b.WriteRune(locking[septets[i]&0x7F])
+	}
+
+	return b.String()
+}
+
+func (cs Charset) locking() []rune {
+	if table, ok := lockings[cs.Locking]; ok {
+		return table
+	}
+	return lockings[Default]
+}
+
+func (cs Charset) single() map[byte]rune {
+	if table, ok := singles[cs.Single]; ok {
+		return table
+	}
+	return singles[Default]
+}
+
+func (cs Charset) runeSize(r rune) int {
+	for i, v := range cs.locking() {
+		if v == r && i != escape {
+			return 1
+		}
+	}
+	for _, v := range cs.single() {
+		if v == r {
+			return 2
+		}
+	}
+	return 0
+}
+
+// Type implements the Codec interface.
+func (s GSM7National) Type() DataCoding {
+	return DefaultType
+}
+
+// Encode implements the Codec interface.
+func (s GSM7National) Encode() []byte {
+	return s.EncodeWithUDH(0)
+}
+
+// Decode implements the Codec interface.
+func (s GSM7National) Decode() []byte {
+	return s.DecodeWithUDH(0)
+}
+
+// Validate returns an error if the text cannot be encoded with the charset.
+func (s GSM7National) Validate() error {
+	_, err := s.Charset.Encode(string(s.Text))
+	return err
+}
+
+// EncodeWithUDH encodes the text so it can be appended to a UDH of n bytes (UDHL included).
+// The characters that are not in the charset are replaced by '?', see Validate.
+func (s GSM7National) EncodeWithUDH(n int) []byte {
+	septets, _ := s.Charset.Encode(string(s.Text))
+
+	if !s.Packed {
+		return septets
+	}
+	return pack(septets, n)
+}
+
+// DecodeWithUDH decodes the text that follows a UDH of n bytes (UDHL included).
+func (s GSM7National) DecodeWithUDH(n int) []byte {
+	septets := s.Text
+	if s.Packed {
+		septets = UnpackWithUDH(septets, n)
+	}
+	return []byte(s.Charset.Decode(septets))
+}
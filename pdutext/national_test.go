@@ -0,0 +1,117 @@
+package pdutext_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectCodec_National(t *testing.T) {
+	tests := []struct {
+		message   string
+		languages []pdutext.Language
+		charset   pdutext.Charset
+		size      int
+		segments  int
+	}{
+		{
+			message:   "Günaydın Şükrü, ığdır çok güzel",
+			languages: []pdutext.Language{pdutext.Turkish},
+			charset:   pdutext.Charset{Locking: pdutext.Turkish},
+			size:      31,
+			segments:  1,
+		},
+		{
+			message:   "¿Cómo está? Mañana",
+			languages: []pdutext.Language{pdutext.Spanish, pdutext.Turkish},
+			charset:   pdutext.Charset{Single: pdutext.Spanish},
+			size:      20,
+			segments:  1,
+		},
+		{
+			message:   "Não há ação sem razão",
+			languages: []pdutext.Language{pdutext.Portuguese},
+			charset:   pdutext.Charset{Locking: pdutext.Portuguese},
+			size:      21,
+			segments:  1,
+		},
+		{
+			message:   strings.Repeat("ı", 156),
+			languages: []pdutext.Language{pdutext.Turkish},
+			charset:   pdutext.Charset{Locking: pdutext.Turkish},
+			size:      156,
+			segments:  2, // 155 septets available with the locking shift IE.
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.message, func(t *testing.T) {
+			c, _, _ := pdutext.SelectCodec(test.message)
+			assert.IsType(t, pdutext.UCS2(""), c)
+
+			c, size, segments := pdutext.SelectCodec(test.message, test.languages...)
+			assert.IsType(t, pdutext.GSM7National{}, c)
+			assert.Equal(t, test.charset, c.(pdutext.GSM7National).Charset)
+			assert.Equal(t, test.size, size)
+			assert.Equal(t, test.segments, segments)
+			assert.Equal(t, test.segments, pdutext.Segments(test.message, test.languages...))
+
+			c = pdutext.GSM7National{Text: c.Encode(), Charset: test.charset, Packed: false}
+			assert.Equal(t, test.message, string(c.Decode()))
+		})
+	}
+}
+
+func TestCharset_Limits(t *testing.T) {
+	single, multipart := pdutext.Charset{}.Limits()
+	assert.Equal(t, pdutext.SizeGSM7Single, single)
+	assert.Equal(t, pdutext.SizeGSM7Multipart, multipart)
+
+	single, multipart = pdutext.Charset{Locking: pdutext.Turkish}.Limits()
+	assert.Equal(t, 155, single)
+	assert.Equal(t, 149, multipart)
+
+	single, multipart = pdutext.Charset{Locking: pdutext.Turkish, Single: pdutext.Turkish}.Limits()
+	assert.Equal(t, 152, single)
+	assert.Equal(t, 146, multipart)
+}
+
+func TestCharset_Split(t *testing.T) {
+	cs := pdutext.Charset{Single: pdutext.Spanish}
+	segments := cs.Split(strings.Repeat("a", 5)+"á", 6)
+	assert.Equal(t, []string{"aaaaa", "á"}, segments) // Escape sequence is not split
+}
+
+func TestGSM7National_Packed(t *testing.T) {
+	cs := pdutext.Charset{Locking: pdutext.Turkish, Single: pdutext.Turkish}
+	udh := pdutext.UDH{IEs: append([]pdutext.IE{pdutext.Concatenation{Reference: 1, Total: 2, Sequence: 1}}, cs.IEs()...)}.Bytes()
+
+	ud := pdutext.EncodeUserData(udh, pdutext.GSM7National{Text: []byte("Şeker €"), Charset: cs, Packed: true})
+	text := pdutext.GSM7National{Text: ud[len(udh):], Charset: cs, Packed: true}.DecodeWithUDH(len(udh))
+	assert.Equal(t, "Şeker €", string(text))
+}
+
+func TestGSM7National_Invalid(t *testing.T) {
+	s := pdutext.GSM7National{Text: []byte("Şeker ж"), Charset: pdutext.Charset{Locking: pdutext.Turkish}}
+	assert.Error(t, s.Validate())
+	assert.Equal(t, "Şeker ?", s.Charset.Decode(s.Encode()))
+
+	_, err := pdutext.ParseLanguage("hindi")
+	assert.ErrorContains(t, err, "not implemented")
+	assert.Equal(t, "hindi", pdutext.Hindi.String())
+}
+
+func TestParseUDH_National(t *testing.T) {
+	udh, err := pdutext.ParseUDH([]byte{11, 0, 3, 42, 2, 1, 0x25, 1, 1, 0x24, 1, 3, 'h', 'i'})
+	assert.NoError(t, err)
+	assert.Equal(t, 12, udh.Len())
+	assert.Equal(t, pdutext.Charset{Locking: pdutext.Turkish, Single: pdutext.Portuguese}, udh.Charset())
+
+	udh, err = pdutext.ParseUDH([]byte{3, 0x24, 1, 2, 'h', 'i'})
+	assert.NoError(t, err)
+	_, ok := udh.Concatenation()
+	assert.False(t, ok)
+	assert.Equal(t, pdutext.Charset{Single: pdutext.Spanish}, udh.Charset())
+}
@@ -0,0 +1,218 @@
+package pdutext
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	// SizeOctetSingle is the max number of octets allowed in one SMS.
+	SizeOctetSingle = 140
+	// SizeOctetMultipart is the max number of octets allowed in each chunk of the SMS due to the UDH.
+	SizeOctetMultipart = 134
+)
+
+// 8-bit data coding values.
+const (
+	Latin1Type   DataCoding = 0x03 // Latin 1 (ISO-8859-1)
+	ISO88595Type DataCoding = 0x06 // Cyrillic (ISO-8859-5)
+	ISO88598Type DataCoding = 0x07 // Latin/Hebrew (ISO-8859-8)
+)
+
+type (
+	// Latin1 is ISO-8859-1 coding.
+	Latin1 []byte
+	// DefaultLatin1 is ISO-8859-1 coding sent as the SMSC default alphabet (data_coding 0).
+	DefaultLatin1 []byte
+	// ISO88595 is ISO-8859-5 (Cyrillic) coding.
+	ISO88595 []byte
+	// ISO88598 is ISO-8859-8 (Hebrew) coding.
+	ISO88598 []byte
+	// Binary is 8-bit binary data, no encoding.
+	Binary []byte
+)
+
+// ParseCodec returns the codec of the given name for the given message.
+// The message of the binary codec is hexadecimal.
+// An empty name selects the codec according to the message, see SelectCodec.
+func ParseCodec(name string, message string, languages ...Language) (Codec, error) {
+	switch strings.ToLower(name) {
+	case "", "auto":
+		c, _, _ := SelectCodec(message, languages...)
+		return c, nil
+	case "gsm7", "default":
+		if !IsGSM7(message) {
+			return nil, errors.New("message does not comply with GSM 03.38")
+		}
+		return GSM7(message), nil
+	case "ucs2":
+		return UCS2(message), nil
+	case "latin1", "iso-8859-1":
+		if err := encodable(charmap.ISO8859_1, message); err != nil {
+			return nil, err
+		}
+		return Latin1(message), nil
+	case "cyrillic", "iso-8859-5":
+		if err := encodable(charmap.ISO8859_5, message); err != nil {
+			return nil, err
+		}
+		return ISO88595(message), nil
+	case "hebrew", "iso-8859-8":
+		if err := encodable(charmap.ISO8859_8, message); err != nil {
+			return nil, err
+		}
+		return ISO88598(message), nil
+	case "binary":
+		p, err := hex.DecodeString(message)
+		if err != nil {
+			return nil, errors.Wrap(err, "binary message must be hexadecimal")
+		}
+		return Binary(p), nil
+	}
+
+	return nil, errors.Errorf("unsupported coding: %s", name)
+}
+
+// Count returns the size of the given codec's text and the number of segments used to send it.
+// The size is counted in characters for GSM 7-bit and UCS2, and in octets otherwise.
+func Count(c Codec) (size int, segments int) {
+	switch v := c.(type) {
+	case GSM7:
+		return Size(string(v)), Segments(string(v))
+	case GSM7Packed:
+		return Size(string(v)), Segments(string(v))
+	case GSM7National:
+		return v.Charset.Size(string(v.Text)), v.Charset.Segments(string(v.Text))
+	case UCS2:
+		return Size(string(v)), Segments(string(v))
+	}
+
+	size = len(c.Encode())
+	if size <= SizeOctetSingle {
+		return size, 1
+	}
+
+	segments = size / SizeOctetMultipart
+	if size%SizeOctetMultipart != 0 {
+		segments++
+	}
+	return size, segments
+}
+
+// SplitOctets splits the given data in chunks of at most the given size.
+func SplitOctets(p []byte, size int) [][]byte {
+	var chunks [][]byte
+	for len(p) > size {
+		chunks = append(chunks, p[:size])
+		p = p[size:]
+	}
+	if len(p) > 0 {
+		chunks = append(chunks, p)
+	}
+	return chunks
+}
+
+// Type implements the Codec interface.
+func (s Latin1) Type() DataCoding {
+	return Latin1Type
+}
+
+// Encode to ISO-8859-1.
+func (s Latin1) Encode() []byte {
+	return encode(charmap.ISO8859_1, s)
+}
+
+// Decode from ISO-8859-1.
+func (s Latin1) Decode() []byte {
+	return decode(charmap.ISO8859_1, s)
+}
+
+// Type implements the Codec interface.
+func (s DefaultLatin1) Type() DataCoding {
+	return DefaultType
+}
+
+// Encode to ISO-8859-1.
+func (s DefaultLatin1) Encode() []byte {
+	return encode(charmap.ISO8859_1, s)
+}
+
+// Decode from ISO-8859-1.
+func (s DefaultLatin1) Decode() []byte {
+	return decode(charmap.ISO8859_1, s)
+}
+
+// Type implements the Codec interface.
+func (s ISO88595) Type() DataCoding {
+	return ISO88595Type
+}
+
+// Encode to ISO-8859-5.
+func (s ISO88595) Encode() []byte {
+	return encode(charmap.ISO8859_5, s)
+}
+
+// Decode from ISO-8859-5.
+func (s ISO88595) Decode() []byte {
+	return decode(charmap.ISO8859_5, s)
+}
+
+// Type implements the Codec interface.
+func (s ISO88598) Type() DataCoding {
+	return ISO88598Type
+}
+
+// Encode to ISO-8859-8.
+func (s ISO88598) Encode() []byte {
+	return encode(charmap.ISO8859_8, s)
+}
+
+// Decode from ISO-8859-8.
+func (s ISO88598) Decode() []byte {
+	return decode(charmap.ISO8859_8, s)
+}
+
+// Type implements the Codec interface.
+func (s Binary) Type() DataCoding {
+	return Binary2Type
+}
+
+// Encode binary data.
+func (s Binary) Encode() []byte {
+	return s
+}
+
+// Decode binary data.
+func (s Binary) Decode() []byte {
+	return s
+}
+
+// encodable returns an error if the message has characters that are not in the charmap.
+func encodable(cm *charmap.Charmap, message string) error {
+	if _, err := cm.NewEncoder().String(message); err != nil {
+		return errors.Errorf("message does not comply with %s", cm)
+	}
+	return nil
+}
+
+// encode encodes the text, the characters that are not in the charmap are replaced by SUB (0x1A).
+// ParseCodec rejects such texts beforehand.
+func encode(cm *charmap.Charmap, s []byte) []byte {
+	p, err := encoding.ReplaceUnsupported(cm.NewEncoder()).Bytes(s)
+	if err != nil {
+		return s
+	}
+	return p
+}
+
+func decode(cm *charmap.Charmap, s []byte) []byte {
+	p, err := cm.NewDecoder().Bytes(s)
+	if err != nil {
+		return s
+	}
+	return p
+}
@@ -0,0 +1,60 @@
+package pdutext_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCodec(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		codec    pdutext.Codec
+		coding   pdutext.DataCoding
+		size     int
+		segments int
+	}{
+		{name: "", message: "Hello", codec: pdutext.GSM7("Hello"), coding: 0x00, size: 5, segments: 1},
+		{name: "latin1", message: "Crème brûlée", codec: pdutext.Latin1("Crème brûlée"), coding: 0x03, size: 12, segments: 1},
+		{name: "cyrillic", message: "Привет", codec: pdutext.ISO88595("Привет"), coding: 0x06, size: 6, segments: 1},
+		{name: "hebrew", message: "שלום", codec: pdutext.ISO88598("שלום"), coding: 0x07, size: 4, segments: 1},
+		{name: "binary", message: "cafe", codec: pdutext.Binary{0xCA, 0xFE}, coding: 0x04, size: 2, segments: 1},
+		{name: "latin1", message: strings.Repeat("é", 141), codec: pdutext.Latin1(strings.Repeat("é", 141)), coding: 0x03, size: 141, segments: 2},
+		{name: "binary", message: strings.Repeat("00", 269), codec: pdutext.Binary(make([]byte, 269)), coding: 0x04, size: 269, segments: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := pdutext.ParseCodec(test.name, test.message)
+			assert.NoError(t, err)
+			assert.Equal(t, test.codec, c)
+			assert.Equal(t, test.coding, c.Type())
+
+			size, segments := pdutext.Count(c)
+			assert.Equal(t, test.size, size)
+			assert.Equal(t, test.segments, segments)
+			assert.Len(t, pdutext.SplitOctets(c.Encode(), pdutext.SizeOctetMultipart), segments)
+		})
+	}
+
+	_, err := pdutext.ParseCodec("gsm7", "バカ")
+	assert.Error(t, err)
+	_, err = pdutext.ParseCodec("binary", "xyz")
+	assert.Error(t, err)
+	_, err = pdutext.ParseCodec("ebcdic", "Hello")
+	assert.Error(t, err)
+	_, err = pdutext.ParseCodec("latin1", "cé€")
+	assert.EqualError(t, err, "message does not comply with ISO 8859-1")
+	_, err = pdutext.ParseCodec("cyrillic", "Привет ש")
+	assert.Error(t, err)
+	_, err = pdutext.ParseCodec("hebrew", "שלום ж")
+	assert.Error(t, err)
+}
+
+func TestLatin1(t *testing.T) {
+	assert.Equal(t, []byte{'c', 0xE9, 0x1A}, pdutext.Latin1("cé€").Encode()) // € is not part of ISO-8859-1, replaced by SUB
+	assert.Equal(t, pdutext.DefaultType, pdutext.DefaultLatin1("").Type())
+}
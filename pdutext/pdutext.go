@@ -1,7 +1,7 @@
 package pdutext
 
 import (
-	"unicode/utf8"
+	"strings"
 
 	"github.com/mdouchement/smpp/smpp/pdu/pdutext"
 )
@@ -17,19 +17,23 @@ const (
 	SizeUCS2Multipart = 67
 )
 
+// Supported data_coding values.
+const (
+	DefaultType = pdutext.DefaultType
+	UCS2Type    = pdutext.UCS2Type
+)
+
 type (
+	// DataCoding is the value of the data_coding PDU field.
+	DataCoding = pdutext.DataCoding
 	// Codec to define text codec.
 	Codec = pdutext.Codec
 	// Raw text codec, no encoding.
 	Raw = pdutext.Raw
 	// GSM7 is GSM 7-bit coding (7-bit on 8-bit space).
-	// Not the official format but still used by several tools/SMSC.
+	// Not the official format but still used by several tools/SMSC (e.g. Kannel).
+	// See GSM7Packed for the packed format.
 	GSM7 = pdutext.GSM7
-	// GSM7Packed is GSM 7-bit coding (packed).
-	// This coding allows 160 characters coded over 140 bytes (160 * 7-bit / 8-bit = 140 bytes)
-	// which is the format described in GSM 03.38.
-	// FIXME: should be pdutext.GSM7Packed but it is not supported by Kannel.
-	GSM7Packed = pdutext.GSM7
 	// UCS2 is UCS2 coding (UTF-16BE).
 	UCS2 = pdutext.UCS2
 )
@@ -37,24 +41,35 @@ type (
 // TODO: not optimized, refactor to avoid to use `IsGSM7' each time.
 
 // SelectCodec selects the right codec and computes details.
-func SelectCodec(message string) (c Codec, size int, segments int) {
+// The national language shift tables of the given languages are used
+// when the message does not comply with the GSM 03.38 default alphabet.
+func SelectCodec(message string, languages ...Language) (c Codec, size int, segments int) {
 	if IsGSM7(message) {
-		return GSM7Packed(message), Size(message), Segments(message)
+		return GSM7(message), Size(message), Segments(message)
+	}
+	if cs, ok := SelectCharset(message, languages...); ok && !cs.IsDefault() {
+		return GSM7National{Text: []byte(message), Charset: cs}, cs.Size(message), cs.Segments(message)
 	}
 	return UCS2(message), Size(message), Segments(message)
 }
 
 // Size returns the size of the message.
+// UCS2 messages are measured in UTF-16 code units, see UTF16size.
 func Size(message string) int {
 	if IsGSM7(message) {
 		return GSM7size(message)
 	}
-	return utf8.RuneCountInString(message) // size of the rune array
+	return UTF16size(message)
 }
 
 // Segments returns the number of segments used to send the given message.
-func Segments(message string) int {
+// See SelectCodec for the languages.
+func Segments(message string, languages ...Language) int {
 	if IsGSM7(message) {
+		if GSM7size(message) <= SizeGSM7Single {
+			return 1
+		}
+
 		var segments, s, n int
 		for _, r := range message {
 			n = GSM7size(string(r))
@@ -80,49 +95,59 @@ func Segments(message string) int {
 		return segments
 	}
 
-	size := Size(message)
-	if size <= SizeUCS2Single {
-		return 1
+	if cs, ok := SelectCharset(message, languages...); ok && !cs.IsDefault() {
+		return cs.Segments(message)
 	}
 
-	segments := size / SizeUCS2Multipart
-	if size%SizeUCS2Multipart != 0 {
-		segments++
+	if Size(message) <= SizeUCS2Single {
+		return 1
 	}
 
-	return segments
+	// Surrogate pairs and emoji sequences are not split, segments may not be full.
+	return len(Split(message, SizeUCS2Multipart))
 }
 
 // Split in valid UTF-8 sequences.
+// UCS2 messages are measured in UTF-16 code units and surrogate pairs or emoji sequences (e.g. ZWJ sequences)
+// are never split across segments.
+// See Charset.Split for texts using national language shift tables.
 func Split(message string, size int) []string {
-	var s, n int
-	segment := make([]rune, 0, size+20)
+	measure := UTF16size
+	if IsGSM7(message) {
+		measure = GSM7size
+	}
+
+	var s int
+	var segment strings.Builder
 	var segments []string
 
-	for _, r := range message {
-		n = Size(string(r))
-		s += n
-		switch {
-		case s < size:
-			// Still have place in the current segment.
-			segment = append(segment, r)
-		case s == size:
-			// Segment complete.
-			segment = append(segment, r)
-			segments = append(segments, string(segment))
-			segment = segment[:0]
-			s = 0
-		default:
+	add := func(chars string) {
+		n := measure(chars)
+		if s+n > size && segment.Len() > 0 {
 			// Over segment size.
-			segments = append(segments, string(segment))
-			segment[0] = r
-			segment = segment[:1]
-			s = n
+			segments = append(segments, segment.String())
+			segment.Reset()
+			s = 0
+		}
+
+		segment.WriteString(chars)
+		s += n
+	}
+
+	for _, cluster := range clusters(message) {
+		if measure(cluster) <= size {
+			add(cluster)
+			continue
+		}
+
+		// The sequence does not fit in a segment, fallback on characters.
+		for _, r := range cluster {
+			add(string(r))
 		}
 	}
 
-	if len(segment) > 0 {
-		segments = append(segments, string(segment))
+	if segment.Len() > 0 {
+		segments = append(segments, segment.String())
 	}
 
 	return segments
@@ -0,0 +1,95 @@
+package pdutext_test
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSize_UCS2(t *testing.T) {
+	assert.Equal(t, 2, pdutext.Size("バカ"))
+	assert.Equal(t, 4, pdutext.Size("😀😀"))
+	assert.Equal(t, 7, pdutext.Size("👩‍💻 a")) // 👩 ZWJ 💻 space a
+}
+
+func TestSegments_UCS2(t *testing.T) {
+	assert.Equal(t, 1, pdutext.Segments(strings.Repeat("😀", 35)))
+	assert.Equal(t, 2, pdutext.Segments(strings.Repeat("😀", 36)))
+	assert.Equal(t, 3, pdutext.Segments(strings.Repeat("😀", 67)))
+}
+
+func TestSegments_GSM7(t *testing.T) {
+	assert.Equal(t, 1, pdutext.Segments(strings.Repeat("a", 160)))
+	assert.Equal(t, 2, pdutext.Segments(strings.Repeat("a", 161)))
+	assert.Equal(t, 2, pdutext.Segments(strings.Repeat("a", 159)+"€")) // Escaped, 161 septets
+	assert.Equal(t, 2, pdutext.Segments(strings.Repeat("a", 306)))
+	assert.Equal(t, 3, pdutext.Segments(strings.Repeat("a", 307)))
+
+	size, segments := pdutext.Count(pdutext.GSM7(strings.Repeat("a", 160)))
+	assert.Equal(t, 160, size)
+	assert.Equal(t, 1, segments)
+
+	size, segments = pdutext.Count(pdutext.GSM7Packed(strings.Repeat("a", 154)))
+	assert.Equal(t, 154, size)
+	assert.Equal(t, 1, segments)
+}
+
+func TestReplaceNonGSM7(t *testing.T) {
+	assert.Equal(t, "Hello {world}", pdutext.ReplaceNonGSM7("Hello {world}", '?'))
+	assert.Equal(t, "?????? é", pdutext.ReplaceNonGSM7("Привет é", '?'))
+}
+
+func TestSplit_UCS2(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		segments []string
+	}{
+		{
+			name:     "surrogate pair",
+			message:  strings.Repeat("a", 66) + "😀",
+			segments: []string{strings.Repeat("a", 66), "😀"},
+		},
+		{
+			name:     "zwj sequence",
+			message:  strings.Repeat("バ", 63) + "👨‍👩‍👧",
+			segments: []string{strings.Repeat("バ", 63), "👨‍👩‍👧"},
+		},
+		{
+			name:     "modifier",
+			message:  strings.Repeat("バ", 64) + "👍🏽",
+			segments: []string{strings.Repeat("バ", 64), "👍🏽"},
+		},
+		{
+			name:     "flags",
+			message:  strings.Repeat("バ", 64) + "🇫🇷🇩🇪",
+			segments: []string{strings.Repeat("バ", 64), "🇫🇷🇩🇪"},
+		},
+		{
+			name:     "flags boundary",
+			message:  strings.Repeat("バ", 61) + "🇫🇷🇩🇪",
+			segments: []string{strings.Repeat("バ", 61) + "🇫🇷", "🇩🇪"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			segments := pdutext.Split(test.message, pdutext.SizeUCS2Multipart)
+			assert.Equal(t, test.segments, segments)
+
+			for _, segment := range segments {
+				units := utf16.Encode([]rune(segment))
+				assert.LessOrEqual(t, len(units), pdutext.SizeUCS2Multipart)
+				assert.Equal(t, segment, string(utf16.Decode(units)))
+			}
+		})
+	}
+}
+
+func TestSplit_GSM7(t *testing.T) {
+	segments := pdutext.Split(strings.Repeat("a", 152)+"[", pdutext.SizeGSM7Multipart)
+	assert.Equal(t, []string{strings.Repeat("a", 152), "["}, segments) // Escape sequence is not split
+}
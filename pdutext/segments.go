@@ -0,0 +1,77 @@
+package pdutext
+
+import "github.com/pkg/errors"
+
+// Limits returns the max size of a single SMS and of each segment of a multipart SMS
+// when the UDH contains the given IEs (the concatenation IE is added to the multipart segments).
+// The sizes are counted in septets for GSM 7-bit, in UTF-16 code units for UCS2 and in octets otherwise.
+func Limits(c Codec, udh UDH) (single int, multipart int) {
+	ies := append([]IE(nil), udh.IEs...)
+	if v, ok := c.(GSM7National); ok {
+		ies = append(ies, v.Charset.IEs()...)
+	}
+
+	single = SizeOctetSingle - UDH{IEs: ies}.Len()
+	multipart = SizeOctetSingle - UDH{IEs: append(ies, Concatenation{})}.Len()
+
+	switch c.(type) {
+	case GSM7, GSM7Packed, GSM7National:
+		return single * 8 / 7, multipart * 8 / 7
+	case UCS2:
+		return single / 2, multipart / 2
+	}
+	return single, multipart
+}
+
+// CountWithUDH is like Count when the UDH of each segment contains the given IEs (e.g. application ports).
+func CountWithUDH(c Codec, udh UDH) (size int, segments int) {
+	if len(udh.IEs) == 0 {
+		return Count(c)
+	}
+
+	size, _ = Count(c)
+	single, multipart := Limits(c, udh)
+	if size <= single {
+		return size, 1
+	}
+
+	codecs, err := SplitCodec(c, multipart)
+	if err != nil {
+		return size, 0
+	}
+	return size, len(codecs)
+}
+
+// SplitCodec splits the text of the given codec in segments of at most the given size (see Limits).
+// Single-byte codings are split once encoded and returned as Raw.
+func SplitCodec(c Codec, size int) ([]Codec, error) {
+	var codecs []Codec
+
+	// Content aware splitting
+	switch v := c.(type) {
+	case GSM7:
+		for _, s := range Split(string(v), size) {
+			codecs = append(codecs, GSM7(s))
+		}
+	case GSM7Packed:
+		for _, s := range Split(string(v), size) {
+			codecs = append(codecs, GSM7Packed(s))
+		}
+	case GSM7National:
+		for _, s := range v.Charset.Split(string(v.Text), size) {
+			codecs = append(codecs, GSM7National{Text: []byte(s), Charset: v.Charset, Packed: v.Packed})
+		}
+	case UCS2:
+		for _, s := range Split(string(v), size) {
+			codecs = append(codecs, UCS2(s))
+		}
+	case Latin1, DefaultLatin1, ISO88595, ISO88598, Binary:
+		for _, chunk := range SplitOctets(v.Encode(), size) {
+			codecs = append(codecs, Raw(chunk))
+		}
+	default:
+		return nil, errors.Errorf("unsupported message codec: %T", v)
+	}
+
+	return codecs, nil
+}
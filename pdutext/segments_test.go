@@ -0,0 +1,70 @@
+package pdutext_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimits(t *testing.T) {
+	ports := pdutext.UDH{IEs: []pdutext.IE{pdutext.ApplicationPort{Destination: 2948, Source: 9200, Wide: true}}}
+
+	tests := []struct {
+		name      string
+		codec     pdutext.Codec
+		udh       pdutext.UDH
+		single    int
+		multipart int
+	}{
+		{name: "gsm7", codec: pdutext.GSM7(""), single: 160, multipart: 153},
+		{name: "ucs2", codec: pdutext.UCS2(""), single: 70, multipart: 67},
+		{name: "binary", codec: pdutext.Binary(nil), single: 140, multipart: 134},
+		{name: "binary ports", codec: pdutext.Binary(nil), udh: ports, single: 133, multipart: 128},
+		{name: "gsm7 ports", codec: pdutext.GSM7(""), udh: ports, single: 152, multipart: 146},
+		{
+			name:      "national",
+			codec:     pdutext.GSM7National{Charset: pdutext.Charset{Locking: pdutext.Turkish}},
+			single:    155,
+			multipart: 149,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			single, multipart := pdutext.Limits(test.codec, test.udh)
+			assert.Equal(t, test.single, single)
+			assert.Equal(t, test.multipart, multipart)
+		})
+	}
+}
+
+func TestCountWithUDH(t *testing.T) {
+	ports := pdutext.UDH{IEs: []pdutext.IE{pdutext.ApplicationPort{Destination: 2948, Source: 9200, Wide: true}}}
+
+	size, segments := pdutext.CountWithUDH(pdutext.Binary(make([]byte, 133)), ports)
+	assert.Equal(t, 133, size)
+	assert.Equal(t, 1, segments)
+
+	size, segments = pdutext.CountWithUDH(pdutext.Binary(make([]byte, 134)), ports)
+	assert.Equal(t, 134, size)
+	assert.Equal(t, 2, segments)
+
+	_, segments = pdutext.CountWithUDH(pdutext.GSM7(strings.Repeat("a", 300)), ports)
+	assert.Equal(t, 3, segments)
+}
+
+func TestSplitCodec(t *testing.T) {
+	codecs, err := pdutext.SplitCodec(pdutext.Binary(make([]byte, 200)), 128)
+	assert.NoError(t, err)
+	assert.Len(t, codecs, 2)
+	assert.Len(t, codecs[1].Encode(), 72)
+
+	codecs, err = pdutext.SplitCodec(pdutext.UCS2("バカ"), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []pdutext.Codec{pdutext.UCS2("バ"), pdutext.UCS2("カ")}, codecs)
+
+	_, err = pdutext.SplitCodec(pdutext.Raw("x"), 1)
+	assert.Error(t, err)
+}
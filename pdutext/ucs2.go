@@ -0,0 +1,69 @@
+package pdutext
+
+import "unicode"
+
+const (
+	zwj                = '\u200D' // Zero width joiner
+	keycap             = '\u20E3' // Combining enclosing keycap
+	regionalIndicatorA = '\U0001F1E6'
+	regionalIndicatorZ = '\U0001F1FF'
+	skinToneLight      = '\U0001F3FB'
+	skinToneDark       = '\U0001F3FF'
+	tagSpace           = '\U000E0020'
+	tagCancel          = '\U000E007F'
+)
+
+// UTF16size returns the number of UTF-16 code units of the given string.
+// A character outside the BMP (e.g. an emoji) counts for 2 units (surrogate pair).
+func UTF16size(message string) (size int) {
+	for _, r := range message {
+		size++
+		if r > 0xFFFF {
+			size++ // Surrogate pair
+		}
+	}
+	return size
+}
+
+// clusters splits the message in sequences of characters that must be kept together in the same segment:
+// emoji ZWJ sequences, emoji modifiers, variation selectors, keycaps, tag sequences, flags and combining marks.
+func clusters(message string) []string {
+	var clusters []string
+	var cluster []rune
+	var previous rune
+	var regionalIndicators int
+
+	for _, r := range message {
+		join := len(cluster) > 0 && (previous == zwj ||
+			r == zwj ||
+			r == keycap ||
+			unicode.Is(unicode.Variation_Selector, r) ||
+			unicode.Is(unicode.Mn, r) ||
+			unicode.Is(unicode.Me, r) ||
+			(r >= skinToneLight && r <= skinToneDark) ||
+			(r >= tagSpace && r <= tagCancel) ||
+			(isRegionalIndicator(r) && isRegionalIndicator(previous) && regionalIndicators%2 == 1))
+
+		if !join && len(cluster) > 0 {
+			clusters = append(clusters, string(cluster))
+			cluster = cluster[:0]
+			regionalIndicators = 0
+		}
+
+		if isRegionalIndicator(r) {
+			regionalIndicators++
+		}
+		cluster = append(cluster, r)
+		previous = r
+	}
+
+	if len(cluster) > 0 {
+		clusters = append(clusters, string(cluster))
+	}
+
+	return clusters
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= regionalIndicatorA && r <= regionalIndicatorZ
+}
@@ -5,19 +5,124 @@ import (
 	"errors"
 )
 
-// UDH is the User Define Header which tells a segment details.
-type UDH struct {
-	Bytes    int
-	ID       int
-	Segments int
-	Segment  int
-}
+// Information Element Identifiers as defined in 3GPP 23.040 §9.2.3.24.
+const (
+	IEIConcatenated8        = 0x00 // Concatenated short messages, 8-bit reference number
+	IEISpecialSMSIndication = 0x01 // Special SMS Message Indication
+	IEIPort8                = 0x04 // Application port addressing scheme, 8 bit address
+	IEIPort16               = 0x05 // Application port addressing scheme, 16 bit address
+	IEIConcatenated16       = 0x08 // Concatenated short messages, 16-bit reference number
+	IEITextFormatting       = 0x0A // EMS Text Formatting
+	IEIPredefinedSound      = 0x0B // EMS Predefined Sound
+	IEIUserDefinedSound     = 0x0C // EMS User Defined Sound
+	IEIPredefinedAnimation  = 0x0D // EMS Predefined Animation
+	IEILargeAnimation       = 0x0E // EMS Large Animation
+	IEISmallAnimation       = 0x0F // EMS Small Animation
+	IEILargePicture         = 0x10 // EMS Large Picture
+	IEISmallPicture         = 0x11 // EMS Small Picture
+	IEIVariablePicture      = 0x12 // EMS Variable Picture
+	IEIUserPromptIndicator  = 0x13 // EMS User prompt indicator
+	IEISingleShift          = 0x24 // National Language Single Shift
+	IEILockingShift         = 0x25 // National Language Locking Shift
+)
+
+// Basic message indication types of the Special SMS Message Indication IE (3GPP 23.040 §9.2.3.24.2).
+const (
+	IndicationVoicemail = 0x00
+	IndicationFax       = 0x01
+	IndicationEmail     = 0x02
+	IndicationOther     = 0x03
+)
+
+type (
+	// UDH is the User Data Header, a list of information elements.
+	UDH struct {
+		IEs []IE
+
+		parsed bool // Parsed from a user data, the UDHL is present even without IE
+	}
+
+	// An IE is an information element of the UDH.
+	IE interface {
+		// IEI returns the Information Element Identifier.
+		IEI() byte
+		// Data returns the information element data.
+		Data() []byte
+	}
+
+	// Concatenation is the concatenated short messages IE (8-bit or 16-bit reference number).
+	Concatenation struct {
+		Reference uint16
+		Total     int
+		Sequence  int
+		Wide      bool // 16-bit reference number
+	}
+
+	// ApplicationPort is the application port addressing scheme IE (8-bit or 16-bit address).
+	ApplicationPort struct {
+		Destination uint16
+		Source      uint16
+		Wide        bool // 16-bit address
+	}
+
+	// SpecialSMSIndication is the Special SMS Message Indication IE (e.g. voicemail waiting).
+	SpecialSMSIndication struct {
+		Store bool // Store the message, discarded otherwise
+		Type  byte // Message indication type, profile ID and extended type (7 bits)
+		Count int  // Number of waiting messages
+	}
+
+	// SingleShift is the national language single shift IE.
+	SingleShift Language
+
+	// LockingShift is the national language locking shift IE.
+	LockingShift Language
+
+	// TextFormatting is the EMS text formatting IE.
+	TextFormatting struct {
+		Position int
+		Length   int
+		Mode     byte
+		Color    *byte // Optional
+	}
+
+	// PredefinedSound is the EMS predefined sound IE.
+	PredefinedSound struct {
+		Position int
+		Number   int
+	}
+
+	// PredefinedAnimation is the EMS predefined animation IE.
+	PredefinedAnimation struct {
+		Position int
+		Number   int
+	}
+
+	// UserPromptIndicator is the EMS user prompt indicator IE.
+	UserPromptIndicator struct {
+		Objects int
+	}
+
+	// EMSObject is an EMS object located in the text (user defined sound, animations and pictures).
+	EMSObject struct {
+		ID       byte
+		Position int
+		Object   []byte
+	}
+
+	// RawIE is an unsupported or malformed IE.
+	RawIE struct {
+		ID    byte
+		Value []byte
+	}
+)
 
 // ParseUDH parses the given bytes into an UDH.
+// The given bytes start with the UDHL and may be followed by the text.
 func ParseUDH(p []byte) (UDH, error) {
-	udh := UDH{}
+	udh := UDH{parsed: true}
 
-	if len(p) < 3 {
+	if len(p) < 1 {
 		return udh, errors.New("invalid UDH length")
 	}
 
@@ -25,22 +130,307 @@ func ParseUDH(p []byte) (UDH, error) {
 	if len(p) < l1+1 {
 		return udh, errors.New("invalid UDH length")
 	}
-	udh.Bytes = l1 + 1
 
-	iei := int(p[1])
+	for i := 1; i < l1+1; {
+		if i+2 > l1+1 {
+			return udh, errors.New("invalid UDH IE length")
+		}
+
+		iei, l := p[i], int(p[i+1])
+		if i+2+l > l1+1 {
+			return udh, errors.New("invalid UDH IE length")
+		}
+
+		ie := ParseIE(iei, p[i+2:i+2+l])
+		if v, ok := ie.(Concatenation); ok && (v.Sequence == 0 || v.Sequence > v.Total) {
+			return udh, errors.New("invalid UDH segment value or segments value")
+		}
+
+		udh.IEs = append(udh.IEs, ie)
+		i += 2 + l
+	}
+
+	return udh, nil
+}
+
+// ParseIE returns the typed IE of the given identifier and data.
+// A RawIE is returned for unsupported IEs and when the data length does not match the IE.
+func ParseIE(iei byte, data []byte) IE {
+	data = append([]byte(nil), data...)
+	l := len(data)
+
+	switch {
+	case iei == IEIConcatenated8 && l == 3:
+		return Concatenation{Reference: uint16(data[0]), Total: int(data[1]), Sequence: int(data[2])}
+	case iei == IEIConcatenated16 && l == 4:
+		return Concatenation{Reference: binary.BigEndian.Uint16(data), Total: int(data[2]), Sequence: int(data[3]), Wide: true}
+	case iei == IEIPort8 && l == 2:
+		return ApplicationPort{Destination: uint16(data[0]), Source: uint16(data[1])}
+	case iei == IEIPort16 && l == 4:
+		return ApplicationPort{Destination: binary.BigEndian.Uint16(data), Source: binary.BigEndian.Uint16(data[2:]), Wide: true}
+	case iei == IEISpecialSMSIndication && l == 2:
+		return SpecialSMSIndication{Store: data[0]&0x80 != 0, Type: data[0] & 0x7F, Count: int(data[1])}
+	case iei == IEISingleShift && l == 1:
+		return SingleShift(data[0])
+	case iei == IEILockingShift && l == 1:
+		return LockingShift(data[0])
+	case iei == IEITextFormatting && (l == 3 || l == 4):
+		ie := TextFormatting{Position: int(data[0]), Length: int(data[1]), Mode: data[2]}
+		if l == 4 {
+			ie.Color = &data[3]
+		}
+		return ie
+	case iei == IEIPredefinedSound && l == 2:
+		return PredefinedSound{Position: int(data[0]), Number: int(data[1])}
+	case iei == IEIPredefinedAnimation && l == 2:
+		return PredefinedAnimation{Position: int(data[0]), Number: int(data[1])}
+	case iei == IEIUserPromptIndicator && l == 1:
+		return UserPromptIndicator{Objects: int(data[0])}
+	case iei >= IEIUserDefinedSound && iei <= IEIVariablePicture && iei != IEIPredefinedAnimation && l >= 1:
+		return EMSObject{ID: iei, Position: int(data[0]), Object: data[1:]}
+	}
+
+	return RawIE{ID: iei, Value: data}
+}
+
+// Len returns the number of bytes of the UDH, UDHL included.
+// It returns 0 when there is no IE, unless the UDH has been parsed (e.g. an empty UDH made of UDHL 0).
+func (h UDH) Len() int {
+	if len(h.IEs) == 0 && !h.parsed {
+		return 0
+	}
+
+	n := 1 // UDHL
+	for _, ie := range h.IEs {
+		n += 2 + len(ie.Data())
+	}
+	return n
+}
+
+// Bytes returns the encoded UDH, UDHL included.
+func (h UDH) Bytes() []byte {
+	if len(h.IEs) == 0 && !h.parsed {
+		return nil
+	}
+
+	p := make([]byte, 1, h.Len())
+	for _, ie := range h.IEs {
+		data := ie.Data()
+		p = append(p, ie.IEI(), byte(len(data)))
+		p = append(p, data...)
+	}
+	p[0] = byte(len(p) - 1)
+	return p
+}
+
+// Add appends the given IEs.
+func (h *UDH) Add(ies ...IE) {
+	h.IEs = append(h.IEs, ies...)
+}
+
+// Set replaces the IEs of the same kind as the given IE (e.g. 8-bit and 16-bit concatenation), or appends it.
+func (h *UDH) Set(ie IE) {
+	kind := kindOf(ie.IEI())
+
+	ies := h.IEs[:0]
+	set := false
+	for _, v := range h.IEs {
+		if kindOf(v.IEI()) != kind {
+			ies = append(ies, v)
+			continue
+		}
+		if !set {
+			ies = append(ies, ie)
+			set = true
+		}
+	}
+	if !set {
+		ies = append(ies, ie)
+	}
+	h.IEs = ies
+}
+
+// Concatenation returns the concatenation IE.
+// When repeated, the last occurrence is used (3GPP 23.040 §9.2.3.24).
+func (h UDH) Concatenation() (ie Concatenation, ok bool) {
+	for _, v := range h.IEs {
+		if c, isc := v.(Concatenation); isc {
+			ie, ok = c, true
+		}
+	}
+	return ie, ok
+}
+
+// ApplicationPort returns the application port addressing IE.
+func (h UDH) ApplicationPort() (ie ApplicationPort, ok bool) {
+	for _, v := range h.IEs {
+		if p, isp := v.(ApplicationPort); isp {
+			ie, ok = p, true
+		}
+	}
+	return ie, ok
+}
+
+// SpecialSMSIndications returns the Special SMS Message Indication IEs.
+func (h UDH) SpecialSMSIndications() []SpecialSMSIndication {
+	var ies []SpecialSMSIndication
+	for _, v := range h.IEs {
+		if i, ok := v.(SpecialSMSIndication); ok {
+			ies = append(ies, i)
+		}
+	}
+	return ies
+}
+
+// Charset returns the GSM 7-bit charset announced by the national language shift IEs.
+func (h UDH) Charset() (cs Charset) {
+	for _, v := range h.IEs {
+		switch l := v.(type) {
+		case SingleShift:
+			cs.Single = Language(l)
+		case LockingShift:
+			cs.Locking = Language(l)
+		}
+	}
+	return cs
+}
+
+func kindOf(iei byte) byte {
 	switch iei {
-	case 0x00: // Concatened short message, 8-bit reference number
-		udh.ID = int(p[3])
-	case 0x08: // Concatened short message, 16-bit reference number
-		udh.ID = int(binary.BigEndian.Uint16(p[3:]))
+	case IEIConcatenated16:
+		return IEIConcatenated8
+	case IEIPort16:
+		return IEIPort8
+	}
+	return iei
+}
+
+// IEI implements the IE interface.
+func (ie Concatenation) IEI() byte {
+	if ie.Wide {
+		return IEIConcatenated16
 	}
+	return IEIConcatenated8
+}
+
+// Data implements the IE interface.
+func (ie Concatenation) Data() []byte {
+	if ie.Wide {
+		return []byte{byte(ie.Reference >> 8), byte(ie.Reference), byte(ie.Total), byte(ie.Sequence)}
+	}
+	return []byte{byte(ie.Reference), byte(ie.Total), byte(ie.Sequence)}
+}
 
-	udh.Segments = int(p[l1-1])
-	udh.Segment = int(p[l1])
+// IEI implements the IE interface.
+func (ie ApplicationPort) IEI() byte {
+	if ie.Wide {
+		return IEIPort16
+	}
+	return IEIPort8
+}
 
-	if udh.Segment > udh.Segments {
-		return udh, errors.New("invlid UDH segment value or segments value")
+// Data implements the IE interface.
+func (ie ApplicationPort) Data() []byte {
+	if ie.Wide {
+		return []byte{byte(ie.Destination >> 8), byte(ie.Destination), byte(ie.Source >> 8), byte(ie.Source)}
 	}
+	return []byte{byte(ie.Destination), byte(ie.Source)}
+}
 
-	return udh, nil
+// IEI implements the IE interface.
+func (ie SpecialSMSIndication) IEI() byte {
+	return IEISpecialSMSIndication
+}
+
+// Data implements the IE interface.
+func (ie SpecialSMSIndication) Data() []byte {
+	b := ie.Type & 0x7F
+	if ie.Store {
+		b |= 0x80
+	}
+	return []byte{b, byte(ie.Count)}
+}
+
+// IEI implements the IE interface.
+func (ie SingleShift) IEI() byte {
+	return IEISingleShift
+}
+
+// Data implements the IE interface.
+func (ie SingleShift) Data() []byte {
+	return []byte{byte(ie)}
+}
+
+// IEI implements the IE interface.
+func (ie LockingShift) IEI() byte {
+	return IEILockingShift
+}
+
+// Data implements the IE interface.
+func (ie LockingShift) Data() []byte {
+	return []byte{byte(ie)}
+}
+
+// IEI implements the IE interface.
+func (ie TextFormatting) IEI() byte {
+	return IEITextFormatting
+}
+
+// Data implements the IE interface.
+func (ie TextFormatting) Data() []byte {
+	p := []byte{byte(ie.Position), byte(ie.Length), ie.Mode}
+	if ie.Color != nil {
+		p = append(p, *ie.Color)
+	}
+	return p
+}
+
+// IEI implements the IE interface.
+func (ie PredefinedSound) IEI() byte {
+	return IEIPredefinedSound
+}
+
+// Data implements the IE interface.
+func (ie PredefinedSound) Data() []byte {
+	return []byte{byte(ie.Position), byte(ie.Number)}
+}
+
+// IEI implements the IE interface.
+func (ie PredefinedAnimation) IEI() byte {
+	return IEIPredefinedAnimation
+}
+
+// Data implements the IE interface.
+func (ie PredefinedAnimation) Data() []byte {
+	return []byte{byte(ie.Position), byte(ie.Number)}
+}
+
+// IEI implements the IE interface.
+func (ie UserPromptIndicator) IEI() byte {
+	return IEIUserPromptIndicator
+}
+
+// Data implements the IE interface.
+func (ie UserPromptIndicator) Data() []byte {
+	return []byte{byte(ie.Objects)}
+}
+
+// IEI implements the IE interface.
+func (ie EMSObject) IEI() byte {
+	return ie.ID
+}
+
+// Data implements the IE interface.
+func (ie EMSObject) Data() []byte {
+	return append([]byte{byte(ie.Position)}, ie.Object...)
+}
+
+// IEI implements the IE interface.
+func (ie RawIE) IEI() byte {
+	return ie.ID
+}
+
+// Data implements the IE interface.
+func (ie RawIE) Data() []byte {
+	return ie.Value
 }
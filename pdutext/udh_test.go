@@ -0,0 +1,113 @@
+package pdutext_test
+
+import (
+	"testing"
+
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUDH(t *testing.T) {
+	color := byte(0x12)
+
+	tests := []struct {
+		name string
+		p    []byte
+		ies  []pdutext.IE
+	}{
+		{
+			name: "concatenation 8-bit",
+			p:    []byte{5, 0x00, 3, 42, 2, 1},
+			ies:  []pdutext.IE{pdutext.Concatenation{Reference: 42, Total: 2, Sequence: 1}},
+		},
+		{
+			name: "concatenation 16-bit",
+			p:    []byte{6, 0x08, 4, 0x12, 0x34, 3, 2},
+			ies:  []pdutext.IE{pdutext.Concatenation{Reference: 0x1234, Total: 3, Sequence: 2, Wide: true}},
+		},
+		{
+			name: "wap push",
+			p:    []byte{11, 0x05, 4, 0x0B, 0x84, 0x23, 0xF0, 0x00, 3, 7, 2, 2},
+			ies: []pdutext.IE{
+				pdutext.ApplicationPort{Destination: 2948, Source: 9200, Wide: true},
+				pdutext.Concatenation{Reference: 7, Total: 2, Sequence: 2},
+			},
+		},
+		{
+			name: "port 8-bit",
+			p:    []byte{4, 0x04, 2, 0xF5, 0xF6},
+			ies:  []pdutext.IE{pdutext.ApplicationPort{Destination: 0xF5, Source: 0xF6}},
+		},
+		{
+			name: "voicemail",
+			p:    []byte{4, 0x01, 2, 0x80, 3},
+			ies:  []pdutext.IE{pdutext.SpecialSMSIndication{Store: true, Type: pdutext.IndicationVoicemail, Count: 3}},
+		},
+		{
+			name: "ems",
+			p:    []byte{21, 0x0A, 4, 0, 5, 0x10, 0x12, 0x0B, 2, 5, 1, 0x0D, 2, 6, 3, 0x13, 1, 1, 0x0C, 2, 7, 0xAA},
+			ies: []pdutext.IE{
+				pdutext.TextFormatting{Position: 0, Length: 5, Mode: 0x10, Color: &color},
+				pdutext.PredefinedSound{Position: 5, Number: 1},
+				pdutext.PredefinedAnimation{Position: 6, Number: 3},
+				pdutext.UserPromptIndicator{Objects: 1},
+				pdutext.EMSObject{ID: pdutext.IEIUserDefinedSound, Position: 7, Object: []byte{0xAA}},
+			},
+		},
+		{
+			name: "unsupported and malformed",
+			p:    []byte{7, 0x70, 1, 0xFF, 0x00, 2, 1, 1},
+			ies: []pdutext.IE{
+				pdutext.RawIE{ID: 0x70, Value: []byte{0xFF}},
+				pdutext.RawIE{ID: 0x00, Value: []byte{1, 1}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			udh, err := pdutext.ParseUDH(append(test.p, 'h', 'i'))
+			assert.NoError(t, err)
+			assert.Equal(t, test.ies, udh.IEs)
+			assert.Equal(t, len(test.p), udh.Len())
+			assert.Equal(t, test.p, udh.Bytes())
+		})
+	}
+}
+
+func TestParseUDH_Empty(t *testing.T) {
+	udh, err := pdutext.ParseUDH([]byte{0, 'h', 'i'})
+	assert.NoError(t, err)
+	assert.Empty(t, udh.IEs)
+	assert.Equal(t, 1, udh.Len())
+	assert.Equal(t, []byte{0}, udh.Bytes())
+
+	assert.Equal(t, 0, pdutext.UDH{}.Len())
+}
+
+func TestParseUDH_Invalid(t *testing.T) {
+	for _, p := range [][]byte{
+		{1, 0x00},
+		{5, 0x00, 3, 42},
+		{5, 0x00, 4, 42, 2, 1},
+		{5, 0x00, 3, 42, 2, 3},
+		{5, 0x00, 3, 42, 2, 0},
+	} {
+		_, err := pdutext.ParseUDH(p)
+		assert.Error(t, err, "%v", p)
+	}
+}
+
+func TestUDH_Set(t *testing.T) {
+	udh := pdutext.UDH{}
+	udh.Add(pdutext.Concatenation{Reference: 1, Total: 2, Sequence: 1}, pdutext.SingleShift(pdutext.Turkish))
+	udh.Set(pdutext.Concatenation{Reference: 1, Total: 2, Sequence: 2, Wide: true})
+	udh.Set(pdutext.ApplicationPort{Destination: 0xF5, Source: 0xF5})
+
+	assert.Equal(t, []byte{13, 0x08, 4, 0, 1, 2, 2, 0x24, 1, 1, 0x04, 2, 0xF5, 0xF5}, udh.Bytes())
+
+	c, ok := udh.Concatenation()
+	assert.True(t, ok)
+	assert.Equal(t, 2, c.Sequence)
+	assert.Equal(t, pdutext.Charset{Single: pdutext.Turkish}, udh.Charset())
+}
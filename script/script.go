@@ -0,0 +1,263 @@
+// Package script runs a Lua script hooked on the PDUs handled by the SMSC.
+//
+// The script defines the global functions called on the events:
+//
+//	function on_bind(pdu) return 0 end            -- command_status of the bind_resp
+//	function on_submit_sm(pdu) return {status = 0, dlr = true} end
+//	function on_deliver_sm_resp(pdu) end
+//
+// A PDU is a table with the command, sequence, status, session, fields, tlv and text keys.
+// The global state table is kept when the script is reloaded.
+package script
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mdouchement/logger"
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
+	"github.com/mdouchement/smsc3/dlr"
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/pkg/errors"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type (
+	// An Engine runs a Lua script. It implements smpp.Hook.
+	Engine struct {
+		mu       sync.Mutex
+		log      logger.Logger
+		filename string
+		sessions func(string) *smpp.Session
+		L        *lua.LState
+	}
+
+	// A reference is the PDU received by a session, hidden in the PDU tables.
+	reference struct {
+		session *smpp.Session
+		pdu     pdu.Body
+	}
+)
+
+// New returns a new Engine running the given script.
+// The sessions function returns the session of a system_id for smsc.deliver.
+// The Engine is returned even when the script can not be loaded, so it can be fixed and reloaded.
+func New(l logger.Logger, filename string, sessions func(string) *smpp.Session) (*Engine, error) {
+	e := &Engine{
+		log:      l,
+		filename: filename,
+		sessions: sessions,
+		L:        lua.NewState(),
+	}
+	return e, e.Reload()
+}
+
+// Reload reloads the script. The global state table is kept.
+// The running script is kept when the new one can not be loaded.
+func (e *Engine) Reload() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	L := lua.NewState()
+	state, ok := e.L.GetGlobal("state").(*lua.LTable)
+	if !ok {
+		state = L.NewTable()
+	}
+	L.SetGlobal("state", state)
+	L.SetGlobal("smsc", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"dlr":     e.dlr,
+		"deliver": e.deliver,
+		"log":     e.print,
+	}))
+
+	if err := L.DoFile(e.filename); err != nil {
+		L.Close()
+		return errors.Wrap(err, "script: load")
+	}
+
+	e.L.Close()
+	e.L = L
+	e.log.Infof("Loaded %s", e.filename)
+	return nil
+}
+
+// Close closes the Engine.
+func (e *Engine) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.L.Close()
+}
+
+// Bind calls on_bind with the given bind PDU and returns the command_status of the bind_resp.
+func (e *Engine) Bind(p pdu.Body) pdu.Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status, _ := result(e.call("on_bind", e.table(nil, p)))
+	return status
+}
+
+// SubmitSM calls on_submit_sm with the given submit_sm.
+// It returns a number (the command_status) or a table with the status and dlr keys.
+func (e *Engine) SubmitSM(s *smpp.Session, p pdu.Body) (pdu.Status, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return result(e.call("on_submit_sm", e.table(s, p)))
+}
+
+// DeliverSMResp calls on_deliver_sm_resp with the given deliver_sm_resp.
+func (e *Engine) DeliverSMResp(s *smpp.Session, p pdu.Body) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.call("on_deliver_sm_resp", e.table(s, p))
+}
+
+func (e *Engine) call(name string, args ...lua.LValue) lua.LValue {
+	fn := e.L.GetGlobal(name)
+	if fn.Type() != lua.LTFunction {
+		return lua.LNil
+	}
+
+	err := e.L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args...)
+	if err != nil {
+		e.log.WithError(err).Errorf("Could not run %s", name)
+		return lua.LNil
+	}
+
+	ret := e.L.Get(-1)
+	e.L.Pop(1)
+	return ret
+}
+
+func result(v lua.LValue) (pdu.Status, bool) {
+	switch v := v.(type) {
+	case lua.LNumber:
+		return pdu.Status(v), v == 0
+	case *lua.LTable:
+		status, _ := v.RawGetString("status").(lua.LNumber)
+		return pdu.Status(status), status == 0 && v.RawGetString("dlr") != lua.LFalse
+	}
+	return 0, true
+}
+
+func (e *Engine) table(s *smpp.Session, p pdu.Body) *lua.LTable {
+	h := p.Header()
+
+	t := e.L.NewTable()
+	t.RawSetString("command", lua.LString(h.ID.String()))
+	t.RawSetString("sequence", lua.LNumber(h.Seq))
+	t.RawSetString("status", lua.LNumber(h.Status))
+
+	fields := e.L.NewTable()
+	for k, v := range p.Fields() {
+		switch v := v.(type) {
+		case *pdufield.Fixed:
+			fields.RawSetString(string(k), lua.LNumber(v.Data))
+		case *pdufield.SM:
+			fields.RawSetString(string(k), lua.LString(v.Data)) // See the decoded text
+		default:
+			fields.RawSetString(string(k), lua.LString(v.String()))
+		}
+	}
+	t.RawSetString("fields", fields)
+
+	tlv := e.L.NewTable()
+	for k, v := range p.TLVFields() {
+		switch b := v.Bytes(); {
+		case len(b) == 1:
+			tlv.RawSetString(smpp.TagString(k), lua.LNumber(b[0]))
+		case k == pdutlv.TagReceiptedMessageID:
+			tlv.RawSetString(smpp.TagString(k), lua.LString(v.String()))
+		default:
+			tlv.RawSetString(smpp.TagString(k), lua.LString(b))
+		}
+	}
+	t.RawSetString("tlv", tlv)
+
+	if s == nil {
+		return t
+	}
+	t.RawSetString("session", lua.LString(s.Account().SystemID))
+
+	switch h.ID {
+	case pdu.SubmitSMID, pdu.DeliverSMID:
+		text, err := smpp.Text(p, s.Account().Alphabet())
+		if err != nil {
+			e.log.WithError(err).Warn("Could not decode the text")
+		}
+		t.RawSetString("text", lua.LString(text))
+	}
+
+	ud := e.L.NewUserData()
+	ud.Value = reference{session: s, pdu: p}
+	t.RawSetString("ref", ud)
+
+	return t
+}
+
+// dlr implements smsc.dlr(pdu, state, {delay = seconds, err = code}): it sends a DLR for the given submit_sm.
+func (e *Engine) dlr(L *lua.LState) int {
+	ud, ok := L.CheckTable(1).RawGetString("ref").(*lua.LUserData)
+	if !ok {
+		L.ArgError(1, "not a received PDU")
+	}
+	ref := ud.Value.(reference)
+
+	state, ok := dlr.ParseState(L.CheckString(2))
+	if !ok {
+		L.ArgError(2, "unknown DLR state")
+	}
+
+	opts := L.OptTable(3, L.NewTable())
+	delay := time.Duration(float64(lua.LVAsNumber(opts.RawGetString("delay"))) * float64(time.Second))
+	outcome := dlr.Outcome{
+		State:   state,
+		Err:     int(lua.LVAsNumber(opts.RawGetString("err"))),
+		Network: dlr.NetworkGSM,
+	}
+
+	if err := ref.session.DLR(ref.pdu, outcome, delay); err != nil {
+		L.RaiseError("%s", err)
+	}
+	return 0
+}
+
+// deliver implements smsc.deliver({session = system_id, from = ..., to = ..., message = ..., delay = seconds}):
+// it sends a deliver_sm to the session.
+func (e *Engine) deliver(L *lua.LState) int {
+	opts := L.CheckTable(1)
+	name := lua.LVAsString(opts.RawGetString("session"))
+	delay := time.Duration(float64(lua.LVAsNumber(opts.RawGetString("delay"))) * float64(time.Second))
+
+	session := e.sessions(name)
+	if session == nil {
+		L.RaiseError("session %s not found", name)
+	}
+
+	c, _, _ := pdutext.SelectCodec(lua.LVAsString(opts.RawGetString("message")))
+	m := &smpp.Message{
+		Src:  lua.LVAsString(opts.RawGetString("from")),
+		Dst:  lua.LVAsString(opts.RawGetString("to")),
+		Text: c,
+	}
+
+	go func() {
+		time.Sleep(delay)
+		if err := session.Send(m, pdu.NewDeliverSM()); err != nil {
+			e.log.WithError(err).Errorf("Could not deliver the message to %s", name)
+		}
+	}()
+	return 0
+}
+
+// print implements smsc.log(message).
+func (e *Engine) print(L *lua.LState) int {
+	e.log.Info(L.CheckString(1))
+	return 0
+}
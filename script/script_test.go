@@ -0,0 +1,99 @@
+package script_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/logger"
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/mdouchement/smsc3/script"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const source = `
+state.submitted = state.submitted or 0
+
+function on_bind(pdu)
+	if pdu.fields.system_id == "banned" then
+		return 0x0D -- ESME_RBINDFAIL
+	end
+	return 0
+end
+
+function on_submit_sm(pdu)
+	state.submitted = state.submitted + 1
+	if pdu.fields.destination_addr == "33600000000" then
+		return 0x0B -- ESME_RINVDSTADR
+	end
+	if pdu.text == "fail" then
+		smsc.dlr(pdu, "UNDELIV", {err = 12})
+		return {status = 0, dlr = false}
+	end
+	return {status = 0, dlr = state.submitted % 2 == 1}
+end
+`
+
+func TestEngine(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "hooks.lua")
+	assert.NoError(t, os.WriteFile(filename, []byte(source), 0o600))
+
+	l := logger.WrapLogrus(logrus.New())
+	e, err := script.New(l, filename, func(string) *smpp.Session { return nil })
+	assert.NoError(t, err)
+	defer e.Close()
+
+	bind := pdu.NewBindTransceiver()
+	bind.Fields().Set(pdufield.SystemID, "banned")
+	assert.Equal(t, pdu.Status(0x0D), e.Bind(bind))
+	bind.Fields().Set(pdufield.SystemID, "esme")
+	assert.Equal(t, pdu.Status(0), e.Bind(bind))
+
+	c, esme := net.Pipe()
+	defer esme.Close()
+	session := smpp.NewSession(l, smpp.NewConnection(l, c), &smpp.Account{SystemID: "esme"})
+
+	submit := func(dst, text string) pdu.Body {
+		p := pdu.NewSubmitSM(nil)
+		p.Fields().Set(pdufield.SourceAddr, "GOPHER")
+		p.Fields().Set(pdufield.DestinationAddr, dst)
+		p.Fields().Set(pdufield.MessageID, "id")
+		p.Fields().Set(pdufield.ShortMessage, pdutext.GSM7(text))
+		return p
+	}
+
+	status, dlr := e.SubmitSM(session, submit("33600000001", "hello"))
+	assert.Equal(t, pdu.Status(0), status)
+	assert.True(t, dlr)
+
+	assert.NoError(t, e.Reload()) // The state is kept
+
+	status, dlr = e.SubmitSM(session, submit("33600000001", "hello"))
+	assert.Equal(t, pdu.Status(0), status)
+	assert.False(t, dlr)
+
+	status, _ = e.SubmitSM(session, submit("33600000000", "hello"))
+	assert.Equal(t, pdu.Status(0x0B), status)
+
+	status, dlr = e.SubmitSM(session, submit("33600000001", "fail"))
+	assert.Equal(t, pdu.Status(0), status)
+	assert.False(t, dlr)
+
+	esme.SetReadDeadline(time.Now().Add(time.Second))
+	p, err := pdu.Decode(esme)
+	if assert.NoError(t, err) {
+		assert.Equal(t, pdu.DeliverSMID, p.Header().ID)
+		assert.Contains(t, p.Fields()[pdufield.ShortMessage].String(), "stat:UNDELIV err:012")
+	}
+
+	assert.NoError(t, os.WriteFile(filename, []byte("function ("), 0o600))
+	assert.Error(t, e.Reload())
+	bind.Fields().Set(pdufield.SystemID, "banned")
+	assert.Equal(t, pdu.Status(0x0D), e.Bind(bind)) // The previous script is kept
+}
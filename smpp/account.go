@@ -0,0 +1,141 @@
+package smpp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mdouchement/smsc3/dlr"
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/pkg/errors"
+)
+
+// Message ID modes used for multipart submit_sm.
+const (
+	// MessageIDPerMessage returns the same message_id for every segment and sends one DLR for the whole message.
+	MessageIDPerMessage = "message"
+	// MessageIDPerSegment returns a distinct message_id for each segment and sends one DLR per segment.
+	MessageIDPerSegment = "segment"
+)
+
+// GSM 03.38 formats used for the data_coding 0.
+const (
+	// GSM7Unpacked stores each septet in one octet. It is the format used by Kannel.
+	GSM7Unpacked = "unpacked"
+	// GSM7Packed packs the septets as described in GSM 03.38.
+	GSM7Packed = "packed"
+)
+
+// Alphabets of the SMSC default data_coding (0).
+const (
+	// AlphabetGSM7 codes the texts with GSM 03.38, see the GSM7 setting.
+	AlphabetGSM7 = "gsm7"
+	// AlphabetLatin1 codes the texts with ISO-8859-1.
+	AlphabetLatin1 = "latin1"
+)
+
+// DLR modes.
+const (
+	// DLRAuto sends the DLRs one second after the submit_sm.
+	DLRAuto = "auto"
+	// DLRManual holds the DLRs until they are triggered, see Session.SendDLR.
+	DLRManual = "manual"
+)
+
+// An Account holds the settings of an ESME bound to the SMSC.
+type Account struct {
+	SystemID        string             `json:"system_id"`
+	Password        string             `json:"password"`
+	MessageID       string             `json:"message_id"`
+	GSM7            string             `json:"gsm7"`
+	DefaultAlphabet string             `json:"default_alphabet"`
+	Languages       []pdutext.Language `json:"languages"`
+	DLR             *dlr.Template      `json:"dlr"`      // Format of the DLRs, a dlr.Presets name or a template
+	Outcomes        []*dlr.Rule        `json:"outcomes"` // Outcome of the submitted messages by destination, delivered by default
+	DLRMode         string             `json:"dlr_mode"` // auto (default) or manual
+}
+
+// PerSegment returns true if each segment of a multipart message has its own message_id and DLR.
+func (a *Account) PerSegment() bool {
+	return a != nil && a.MessageID == MessageIDPerSegment
+}
+
+// ManualDLR returns true if the DLRs are held until they are triggered.
+func (a *Account) ManualDLR() bool {
+	return a != nil && a.DLRMode == DLRManual
+}
+
+// Packed returns true if the GSM 7-bit texts are packed.
+func (a *Account) Packed() bool {
+	return a != nil && a.GSM7 == GSM7Packed
+}
+
+// Alphabet returns how the texts using the SMSC default data_coding are coded.
+func (a *Account) Alphabet() pdutext.DefaultAlphabet {
+	switch {
+	case a == nil:
+		return pdutext.DefaultGSM7
+	case a.DefaultAlphabet == AlphabetLatin1:
+		return pdutext.DefaultISO88591
+	case a.Packed():
+		return pdutext.DefaultGSM7Packed
+	}
+	return pdutext.DefaultGSM7
+}
+
+// Compile compiles the DLR outcome rules, the invalid ones are removed.
+func (a *Account) Compile() error {
+	var errs []string
+	rules := a.Outcomes[:0]
+	for i, rule := range a.Outcomes {
+		if err := rule.Compile(); err != nil {
+			errs = append(errs, fmt.Sprintf("outcome %d: %s", i, err))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	a.Outcomes = rules
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Outcome returns the delivery outcome of a message sent to the given destination number,
+// according to the first matching rule.
+func (a *Account) Outcome(dst string) dlr.Outcome {
+	if a != nil {
+		for _, rule := range a.Outcomes {
+			if rule.Matches(dst) {
+				return rule.Outcome()
+			}
+		}
+	}
+	return dlr.Outcome{State: dlr.Delivered, Network: dlr.NetworkGSM}
+}
+
+// Template returns the template of the DLRs sent to the account.
+func (a *Account) Template() dlr.Template {
+	if a == nil || a.DLR == nil {
+		return dlr.Template{}
+	}
+	return *a.DLR
+}
+
+// Codec adapts the given codec to the account settings.
+// The default alphabet is not used when the text is sent with a GSM 03.38 data coding group (e.g. message class).
+func (a *Account) Codec(c pdutext.Codec, group bool) pdutext.Codec {
+	switch v := c.(type) {
+	case pdutext.GSM7:
+		switch {
+		case a.Alphabet() == pdutext.DefaultISO88591 && !group:
+			return pdutext.DefaultLatin1(v)
+		case a.Packed():
+			return pdutext.GSM7Packed(v)
+		}
+	case pdutext.GSM7National:
+		v.Packed = a.Packed()
+		return v
+	}
+	return c
+}
@@ -2,15 +2,21 @@ package smpp
 
 import (
 	"net"
+	"sync"
 
 	"github.com/mdouchement/logger"
 	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smsc3/pdutext"
 )
 
 // A Connection embedds a net.Conn decorated with a dumper.
 type Connection struct {
 	net.Conn
 	log logger.Logger
+	mu  sync.Mutex // Serializes the writes, a PDU is written in several calls
+
+	// Alphabet tells the dumper how the texts using the SMSC default data_coding are coded.
+	Alphabet pdutext.DefaultAlphabet
 }
 
 // NewConnection return a new Connection
@@ -25,13 +31,17 @@ func NewConnection(l logger.Logger, c net.Conn) *Connection {
 func (c *Connection) Decode() (pdu.Body, error) {
 	p, err := pdu.Decode(c.Conn)
 	if err == nil {
-		Dump(c.log, p)
+		dump(c.log, p, c.Alphabet)
 	}
 	return p, err
 }
 
 // Serialize writes the given PDU on the connection.
+// It is safe to call from several goroutines.
 func (c *Connection) Serialize(p pdu.Body) error {
-	Dump(c.log, p)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dump(c.log, p, c.Alphabet)
 	return p.SerializeTo(c)
 }
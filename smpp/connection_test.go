@@ -0,0 +1,44 @@
+package smpp_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/mdouchement/logger"
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnection_Serialize(t *testing.T) {
+	l := logger.WrapLogrus(logrus.New())
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	c := smpp.NewConnection(l, client)
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := pdu.NewSubmitSM(nil)
+			p.Fields().Set(pdufield.DestinationAddr, "33600000001")
+			p.Fields().Set(pdufield.ShortMessage, "hello")
+			assert.NoError(t, c.Serialize(p))
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		p, err := pdu.Decode(server)
+		require.NoError(t, err)
+		assert.Equal(t, pdu.SubmitSMID, p.Header().ID)
+		assert.Equal(t, "hello", p.Fields()[pdufield.ShortMessage].String())
+	}
+	wg.Wait()
+}
@@ -2,16 +2,23 @@ package smpp
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"strings"
 
 	"github.com/mdouchement/logger"
 	"github.com/mdouchement/smpp/smpp/pdu"
 	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
 	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
+	"github.com/mdouchement/smsc3/pdutext"
 )
 
 // Dump displays logs the given PDU data.
 func Dump(l logger.Logger, p pdu.Body) {
+	dump(l, p, pdutext.DefaultGSM7)
+}
+
+func dump(l logger.Logger, p pdu.Body, alphabet pdutext.DefaultAlphabet) {
 	h := p.Header()
 
 	b := make([]byte, 4)
@@ -31,18 +38,61 @@ func Dump(l logger.Logger, p pdu.Body) {
 		l = l.WithField("tlv."+TagString(k), tlv(v))
 	}
 
+	// Human-readable text
+	switch h.ID {
+	case pdu.SubmitSMID, pdu.DeliverSMID, pdu.SubmitMultiID:
+		text, err := Text(p, alphabet)
+		if err != nil {
+			l = l.WithField("text_error", err.Error())
+		}
+		l = l.WithField("text", text)
+
+		if v := p.Fields()[pdufield.DataCoding]; v != nil {
+			if class := pdutext.Class(pdutext.DataCoding(v.Bytes()[0])); class != pdutext.ClassNone {
+				l = l.WithField("message_class", class.String())
+			}
+		}
+
+		if v := p.Fields()[pdufield.ProtocolID]; v != nil {
+			if pid := ProtocolIDString(v.Bytes()[0]); pid != "" {
+				l = l.WithField("message_type", pid)
+			}
+		}
+
+		if udh, err := UserDataHeader(p); err == nil {
+			if port, ok := udh.ApplicationPort(); ok {
+				l = l.WithField("application_port", fmt.Sprintf("%d/%d", port.Destination, port.Source))
+			}
+		}
+
+		var indications []string
+		for _, mw := range MessageWaiting(p) {
+			indications = append(indications, mw.String())
+		}
+		if len(indications) > 0 {
+			l = l.WithField("message_waiting", strings.Join(indications, ", "))
+		}
+	}
+
 	l.WithPrefixf("[%s]", h.ID).Info("PDU")
 }
 
 func field(b pdufield.Body) string {
-	if v, ok := b.(*pdufield.Fixed); ok {
+	switch v := b.(type) {
+	case *pdufield.Fixed:
 		return fmt.Sprintf("0x%02X", v.Data)
+	case *pdufield.SM:
+		return hex.EncodeToString(v.Data) // See the decoded text
 	}
 
 	return b.String()
 }
 
 func tlv(b pdutlv.Body) string {
+	if v, ok := b.(*pdutlv.Field); ok && v.Tag == pdutlv.TagMessagePayload {
+		return hex.EncodeToString(v.Data) // See the decoded text
+	}
+
 	if len(b.Bytes()) == 1 {
 		// Almost of the time an integer in that case.
 		return fmt.Sprintf("0x%02X", b.Bytes()[0])
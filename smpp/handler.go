@@ -0,0 +1,234 @@
+package smpp
+
+import (
+	"sync"
+
+	"github.com/mdouchement/basex"
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
+)
+
+type (
+	// A Handler responds to a PDU sent by the ESME.
+	// It returns the response sent to the ESME, nil for none.
+	Handler interface {
+		ServeSMPP(s *Session, p pdu.Body) pdu.Body
+	}
+
+	// The HandlerFunc type is an adapter to allow the use of ordinary functions as SMPP handlers.
+	HandlerFunc func(s *Session, p pdu.Body) pdu.Body
+
+	// A Middleware wraps a Handler (e.g. logging, authorization, fault injection).
+	Middleware func(Handler) Handler
+
+	// A ServeMux dispatches the PDUs to the handler registered for their command ID.
+	// The commands without handler are answered with a generic_nack.
+	ServeMux struct {
+		mu          sync.RWMutex
+		handlers    map[pdu.ID]Handler
+		middlewares []Middleware
+	}
+)
+
+// Default handlers of the supported commands.
+var (
+	// EnquireLinkHandler answers the enquire_link (ping/heartbeat).
+	EnquireLinkHandler Handler = HandlerFunc(func(s *Session, p pdu.Body) pdu.Body {
+		return pdu.NewEnquireLinkRespSeq(p.Header().Seq)
+	})
+
+	// DeliverSMRespHandler acknowledges the messages and DLRs sent to the ESME, see Session.Send.
+	DeliverSMRespHandler Handler = HandlerFunc(func(s *Session, p pdu.Body) pdu.Body {
+		s.log.Infof("ACK sms/dlr")
+		s.AddPDU(p)
+
+		if hook := s.Hook(); hook != nil {
+			hook.DeliverSMResp(s, p)
+		}
+		return nil
+	})
+
+	// SubmitSMHandler receives the messages submitted by the ESME: the multipart messages are reassembled,
+	// the USSD dialogs are tracked and the DLRs are sent.
+	SubmitSMHandler Handler = HandlerFunc(func(s *Session, p pdu.Body) pdu.Body {
+		return s.submitSM(p)
+	})
+
+	// UnbindHandler answers the end of session asked by the ESME. The session is closed by Listen.
+	UnbindHandler Handler = HandlerFunc(func(s *Session, p pdu.Body) pdu.Body {
+		s.log.Infof("Unbinding session %s", s.systemID)
+		return pdu.NewUnbindRespSeq(p.Header().Seq)
+	})
+
+	// UnbindRespHandler receives the end of session asked by the SMSC.
+	UnbindRespHandler Handler = HandlerFunc(func(s *Session, p pdu.Body) pdu.Body {
+		s.log.Infof("Unbinded session %s", s.systemID)
+		return nil
+	})
+
+	// GenericNACKHandler logs the generic_nack sent by the ESME.
+	GenericNACKHandler Handler = HandlerFunc(func(s *Session, p pdu.Body) pdu.Body {
+		s.log.Warn(p.Header().Status.Error())
+		return nil
+	})
+
+	// NotSupportedHandler answers the unsupported commands.
+	NotSupportedHandler Handler = HandlerFunc(func(s *Session, p pdu.Body) pdu.Body {
+		r := pdu.NewGenericNACK()
+		r.Header().Seq = p.Header().Seq
+		r.Header().Status = 0x00000003 // Invalid Command ID
+		return r
+	})
+)
+
+// ServeSMPP calls f(s, p).
+func (f HandlerFunc) ServeSMPP(s *Session, p pdu.Body) pdu.Body {
+	return f(s, p)
+}
+
+// Chain wraps the handler with the given middlewares, the first one being the outermost.
+func Chain(h Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Recover is a middleware answering a generic_nack (system error) when the handler panics.
+func Recover(next Handler) Handler {
+	return HandlerFunc(func(s *Session, p pdu.Body) (r pdu.Body) {
+		defer func() {
+			if v := recover(); v != nil {
+				s.log.WithField("panic", v).Errorf("smpp: %s handler", p.Header().ID)
+				r = pdu.NewGenericNACK()
+				r.Header().Seq = p.Header().Seq
+				r.Header().Status = 0x00000008 // System Error
+			}
+		}()
+		return next.ServeSMPP(s, p)
+	})
+}
+
+// NewServeMux returns a new ServeMux with the default handlers, wrapped by the Recover middleware.
+func NewServeMux() *ServeMux {
+	return &ServeMux{
+		middlewares: []Middleware{Recover},
+		handlers: map[pdu.ID]Handler{
+			pdu.EnquireLinkID:   EnquireLinkHandler,
+			pdu.DeliverSMRespID: DeliverSMRespHandler,
+			pdu.SubmitSMID:      SubmitSMHandler,
+			pdu.UnbindID:        UnbindHandler,
+			pdu.UnbindRespID:    UnbindRespHandler,
+			pdu.GenericNACKID:   GenericNACKHandler,
+		},
+	}
+}
+
+// Handle registers the handler for the given command ID, replacing the previous one.
+func (m *ServeMux) Handle(id pdu.ID, h Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handlers[id] = h
+}
+
+// HandleFunc registers the handler function for the given command ID.
+func (m *ServeMux) HandleFunc(id pdu.ID, f func(s *Session, p pdu.Body) pdu.Body) {
+	m.Handle(id, HandlerFunc(f))
+}
+
+// Handler returns the handler registered for the given command ID, without the middlewares.
+func (m *ServeMux) Handler(id pdu.ID) Handler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if h, ok := m.handlers[id]; ok {
+		return h
+	}
+	return NotSupportedHandler
+}
+
+// Use appends middlewares wrapping all the handlers.
+func (m *ServeMux) Use(middlewares ...Middleware) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.middlewares = append(m.middlewares, middlewares...)
+}
+
+// ServeSMPP dispatches the PDU to the handler of its command ID, wrapped by the middlewares.
+func (m *ServeMux) ServeSMPP(s *Session, p pdu.Body) pdu.Body {
+	h := m.Handler(p.Header().ID)
+
+	m.mu.RLock()
+	middlewares := m.middlewares
+	m.mu.RUnlock()
+
+	return Chain(h, middlewares...).ServeSMPP(s, p)
+}
+
+func (s *Session) submitSM(p pdu.Body) pdu.Body {
+	if op := p.TLVFields()[pdutlv.TagUssdServiceOp]; op != nil {
+		// USSD dialog message, no DLR
+		r := pdu.NewSubmitSMRespSeq(p.Header().Seq)
+		if len(op.Bytes()) != 1 {
+			s.log.Warnf("Rejecting submit_sm with an invalid ussd_service_op %x", op.Bytes())
+			r.Header().Status = 0x000000C4 // Invalid Optional Parameter Value
+			return r
+		}
+
+		if err := s.handleUSSD(p); err != nil {
+			s.log.WithError(err).Error("Could not handle USSD message")
+		}
+
+		r.Fields().Set(pdufield.MessageID, basex.GenerateID())
+		return r
+	}
+
+	id, segment, seq, duplicate, err := s.handleSegments(p)
+	if err != nil {
+		s.log.WithError(err).Error("Could not handle submit_sm segments")
+	}
+
+	status, dlr := pdu.Status(0), true
+	if hook := s.Hook(); hook != nil {
+		p.Fields().Set(pdufield.MessageID, id)
+		status, dlr = hook.SubmitSM(s, p)
+	}
+	if status != 0 {
+		s.log.Infof("Rejecting submit_sm %s: %s", id, status.Error())
+		if segment != nil && !duplicate {
+			s.segments.Remove(segment, seq)
+		}
+		r := pdu.NewSubmitSMRespSeq(p.Header().Seq)
+		r.Header().Status = status
+		return r
+	}
+
+	if segment != nil && segment.Completed && !duplicate {
+		s.log.Infof("Multipart message %s completed (%d segments): %s", segment.ID, segment.Key.Total, segment.Text())
+	}
+
+	if segment == nil || (segment.Completed && !duplicate) {
+		ids := []string{id}
+		if segment != nil {
+			p.Fields().Set(pdufield.RegisteredDelivery, segment.RegisteredDelivery)
+			if s.account.PerSegment() {
+				ids = segment.SegmentIDs()
+			}
+		}
+
+		if routed := s.submit(id, ids, p, segment, dlr); !routed && dlr {
+			text := s.text(p, segment)
+			for _, id := range ids {
+				p.Fields().Set(pdufield.MessageID, id)
+				s.DLRs(p, text)
+			}
+		}
+	}
+
+	r := pdu.NewSubmitSMRespSeq(p.Header().Seq)
+	r.Fields().Set(pdufield.MessageID, id)
+	return r
+}
@@ -0,0 +1,158 @@
+package smpp_test
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/mdouchement/logger"
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeMux(t *testing.T) {
+	l := logger.WrapLogrus(logrus.New())
+	c, _ := net.Pipe()
+	s := smpp.NewSession(l, smpp.NewConnection(l, c), &smpp.Account{SystemID: "esme"})
+
+	mux := smpp.NewServeMux()
+
+	r := mux.ServeSMPP(s, pdu.NewEnquireLink())
+	assert.Equal(t, pdu.EnquireLinkRespID, r.Header().ID) // Default handler
+
+	r = mux.ServeSMPP(s, pdu.NewQuerySM())
+	assert.Equal(t, pdu.GenericNACKID, r.Header().ID)
+	assert.Equal(t, pdu.Status(0x03), r.Header().Status) // Invalid Command ID
+
+	query := pdu.NewQuerySM()
+	query.Header().Seq = 42
+	r = mux.ServeSMPP(s, query)
+	assert.Equal(t, query.Header().Seq, r.Header().Seq)
+
+	mux.HandleFunc(pdu.QuerySMID, func(*smpp.Session, pdu.Body) pdu.Body {
+		panic("boom")
+	})
+	r = mux.ServeSMPP(s, query) // Recovered by default
+	assert.Equal(t, pdu.GenericNACKID, r.Header().ID)
+	assert.Equal(t, pdu.Status(0x08), r.Header().Status) // System Error
+	assert.Equal(t, query.Header().Seq, r.Header().Seq)
+
+	var calls []string
+	trace := func(name string) smpp.Middleware {
+		return func(next smpp.Handler) smpp.Handler {
+			return smpp.HandlerFunc(func(s *smpp.Session, p pdu.Body) pdu.Body {
+				calls = append(calls, name)
+				return next.ServeSMPP(s, p)
+			})
+		}
+	}
+	mux.Use(trace("first"), trace("second"))
+
+	mux.HandleFunc(pdu.SubmitSMID, func(s *smpp.Session, p pdu.Body) pdu.Body {
+		calls = append(calls, "handler")
+		r := pdu.NewSubmitSMRespSeq(p.Header().Seq)
+		r.Header().Status = 0x58 // Throttling error (fault injection)
+		return r
+	})
+
+	submit := pdu.NewSubmitSM(nil)
+	submit.Fields().Set(pdufield.DestinationAddr, "33600000001")
+	r = mux.ServeSMPP(s, submit)
+	assert.Equal(t, pdu.Status(0x58), r.Header().Status)
+	assert.Equal(t, submit.Header().Seq, r.Header().Seq)
+	assert.Equal(t, []string{"first", "second", "handler"}, calls)
+
+	assert.NotNil(t, mux.Handler(pdu.EnquireLinkID))
+}
+
+func TestRecover(t *testing.T) {
+	l := logger.WrapLogrus(logrus.New())
+	c, _ := net.Pipe()
+	s := smpp.NewSession(l, smpp.NewConnection(l, c), &smpp.Account{SystemID: "esme"})
+
+	h := smpp.Chain(smpp.HandlerFunc(func(*smpp.Session, pdu.Body) pdu.Body {
+		panic("boom")
+	}), smpp.Recover)
+
+	p := pdu.NewSubmitSM(nil)
+	r := h.ServeSMPP(s, p)
+	assert.Equal(t, pdu.GenericNACKID, r.Header().ID)
+	assert.Equal(t, pdu.Status(0x08), r.Header().Status)
+	assert.Equal(t, p.Header().Seq, r.Header().Seq)
+}
+
+func TestSubmitSMHandler_InvalidUSSD(t *testing.T) {
+	l := logger.WrapLogrus(logrus.New())
+	c, _ := net.Pipe()
+	s := smpp.NewSession(l, smpp.NewConnection(l, c), &smpp.Account{SystemID: "esme"})
+
+	submit := pdu.NewSubmitSM(nil)
+	submit.Fields().Set(pdufield.DestinationAddr, "33600000001")
+	submit.TLVFields().Set(pdutlv.TagUssdServiceOp, []byte{})
+
+	r := smpp.NewServeMux().ServeSMPP(s, submit)
+	assert.Equal(t, pdu.SubmitSMRespID, r.Header().ID)
+	assert.Equal(t, pdu.Status(0xC4), r.Header().Status) // Invalid Optional Parameter Value
+}
+
+type rejectOnce struct {
+	calls int
+}
+
+func (h *rejectOnce) SubmitSM(*smpp.Session, pdu.Body) (pdu.Status, bool) {
+	h.calls++
+	if h.calls == 2 {
+		return 0x58, false // Throttling error
+	}
+	return 0, true
+}
+
+func (h *rejectOnce) DeliverSMResp(*smpp.Session, pdu.Body) {}
+
+func TestSubmitSMHandler_RejectedSegment(t *testing.T) {
+	l := logger.WrapLogrus(logrus.New())
+	c, _ := net.Pipe()
+	s := smpp.NewSession(l, smpp.NewConnection(l, c), &smpp.Account{SystemID: "esme"})
+	s.SetHook(&rejectOnce{})
+
+	var completed []smpp.Submitted
+	s.OnSubmit(func(m smpp.Submitted) bool {
+		completed = append(completed, m)
+		return true
+	})
+
+	text := strings.Repeat("long message ", 20)
+	codec, _, _ := pdutext.SelectCodec(text)
+	m := &smpp.Message{Src: "GOPHER", Dst: "+33600000001", Text: codec}
+	var parts []pdu.Body
+	assert.NoError(t, m.Encode(pdu.NewSubmitSM(nil), 42, func(p pdu.Body) error {
+		var b bytes.Buffer
+		if err := p.SerializeTo(&b); err != nil {
+			return err
+		}
+		p, err := pdu.Decode(&b) // The same PDU is reused for each segment
+		parts = append(parts, p)
+		return err
+	}))
+	assert.Len(t, parts, 2)
+
+	mux := smpp.NewServeMux()
+	r := mux.ServeSMPP(s, parts[0])
+	assert.Equal(t, pdu.Status(0), r.Header().Status)
+
+	r = mux.ServeSMPP(s, parts[1])
+	assert.Equal(t, pdu.Status(0x58), r.Header().Status)
+	assert.Empty(t, completed) // The rejected segment is not counted
+
+	r = mux.ServeSMPP(s, parts[1]) // Retry
+	assert.Equal(t, pdu.Status(0), r.Header().Status)
+	if assert.Len(t, completed, 1) {
+		assert.Equal(t, text, completed[0].Text)
+	}
+}
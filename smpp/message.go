@@ -1,11 +1,37 @@
 package smpp
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/mdouchement/smpp/smpp/pdu"
 	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
 	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
+	"github.com/mdouchement/smsc3/address"
 	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/pkg/errors"
+)
+
+// Values of the dest_addr_subunit TLV (SMPP 3.4 §5.3.2.1).
+const (
+	SubunitUnknown         uint8 = 0x00
+	SubunitMSDisplay       uint8 = 0x01 // Flash SMS
+	SubunitMobileEquipment uint8 = 0x02
+	SubunitSmartCard       uint8 = 0x03 // (U)SIM
+	SubunitExternalUnit    uint8 = 0x04
+)
+
+// Values of the protocol_id handled by the simulated handsets (3GPP 23.040 §9.2.3.9).
+const (
+	ProtocolIDDefault  uint8 = 0x00
+	ProtocolIDSilent   uint8 = 0x40 // Short Message Type 0, acknowledged but neither stored nor displayed
+	ProtocolIDReplace1 uint8 = 0x41 // Replace Short Message Type 1
+	ProtocolIDReplace2 uint8 = 0x42
+	ProtocolIDReplace3 uint8 = 0x43
+	ProtocolIDReplace4 uint8 = 0x44
+	ProtocolIDReplace5 uint8 = 0x45
+	ProtocolIDReplace6 uint8 = 0x46
+	ProtocolIDReplace7 uint8 = 0x47 // Replace Short Message Type 7
 )
 
 // A Message configures a short message that can be submitted via the Session.
@@ -20,6 +46,9 @@ type Message struct {
 	Text     pdutext.Codec
 	Validity time.Duration
 	Register pdufield.DeliverySetting
+	UDH      pdutext.UDH             // Information elements added to the UDH of each segment (e.g. application ports)
+	Class    pdutext.MessageClass    // Message class carried by the data_coding (e.g. flash SMS)
+	Waiting  *pdutext.MessageWaiting // Message waiting indication carried by the data_coding
 
 	// Other fields, normally optional.
 	TLVFields            pdutlv.Fields
@@ -31,4 +60,231 @@ type Message struct {
 	ReplaceIfPresentFlag uint8
 	SMDefaultMsgID       uint8
 	NumberDests          uint8
+	DestAddrSubunit      uint8
+}
+
+// DataCoding returns the data_coding of the message, see the Class and Waiting fields.
+func (m *Message) DataCoding() (pdutext.DataCoding, error) {
+	switch {
+	case m.Waiting != nil && m.Class != pdutext.ClassNone:
+		return m.Text.Type(), errors.New("message class and message waiting indication are exclusive")
+	case m.Waiting != nil:
+		return m.Waiting.Coding(m.Text)
+	}
+	return pdutext.ClassCoding(m.Text, m.Class)
+}
+
+// Encode fills the given PDU (submit_sm or deliver_sm) with the message and calls send with each segment,
+// the PDU being reused between the segments. The reference is the CSMS reference number of a multipart message.
+// The text must be adapted to the receiving account beforehand, see Account.Codec.
+func (m *Message) Encode(p pdu.Body, reference uint8, send func(pdu.Body) error) error {
+	if v, ok := m.Text.(pdutext.GSM7National); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+
+	m.Size, m.Segments = pdutext.CountWithUDH(m.Text, m.UDH)
+
+	m.defaults(p)
+	if m.Segments > 1 {
+		return m.multipart(p, reference, send)
+	}
+	return m.single(p, send)
+}
+
+func (m *Message) defaults(p pdu.Body) {
+	f := p.Fields()
+
+	src := address.Parse(m.Src)
+	f.Set(pdufield.SourceAddr, src.String())
+	f.Set(pdufield.SourceAddrTON, src.TON())
+	f.Set(pdufield.SourceAddrNPI, src.NPI())
+
+	dst := address.Parse(m.Dst)
+	f.Set(pdufield.DestinationAddr, dst.String())
+	f.Set(pdufield.DestAddrTON, dst.TON())
+	f.Set(pdufield.DestAddrNPI, dst.NPI())
+
+	f.Set(pdufield.RegisteredDelivery, uint8(m.Register))
+	// Check if the message has validity set.
+	if m.Validity != time.Duration(0) {
+		f.Set(pdufield.ValidityPeriod, ConvertValidity(m.Validity))
+	}
+	f.Set(pdufield.ServiceType, m.ServiceType)
+	f.Set(pdufield.ESMClass, m.ESMClass)
+	f.Set(pdufield.ProtocolID, m.ProtocolID)
+	f.Set(pdufield.PriorityFlag, m.PriorityFlag)
+	f.Set(pdufield.ScheduleDeliveryTime, m.ScheduleDeliveryTime)
+	f.Set(pdufield.ReplaceIfPresentFlag, m.ReplaceIfPresentFlag)
+	f.Set(pdufield.SMDefaultMsgID, m.SMDefaultMsgID)
+
+	tlv := p.TLVFields()
+	if m.DestAddrSubunit != SubunitUnknown {
+		tlv.Set(pdutlv.TagDestAddrSubunit, m.DestAddrSubunit)
+	}
+	for f, b := range m.TLVFields {
+		tlv.Set(f, b)
+	}
+}
+
+func (m *Message) single(p pdu.Body, send func(pdu.Body) error) error {
+	coding, err := m.DataCoding()
+	if err != nil {
+		return err
+	}
+
+	f := p.Fields()
+	f.Set(pdufield.ShortMessage, m.Text)
+
+	udh := pdutext.UDH{IEs: append([]pdutext.IE(nil), m.UDH.IEs...)}
+	if v, ok := m.Text.(pdutext.GSM7National); ok {
+		// The national language shift tables are announced in the UDH.
+		udh.Add(v.Charset.IEs()...)
+	}
+
+	if len(udh.IEs) > 0 {
+		f.Set(pdufield.ShortMessage, pdutext.Raw(pdutext.EncodeUserData(udh.Bytes(), m.Text)))
+		f.Set(pdufield.ESMClass, m.ESMClass|UDHI)
+	}
+	f.Set(pdufield.DataCoding, uint8(coding))
+
+	return send(p)
+}
+
+func (m *Message) multipart(p pdu.Body, reference uint8, send func(pdu.Body) error) error {
+	coding, err := m.DataCoding()
+	if err != nil {
+		return err
+	}
+
+	concatenation := pdutext.Concatenation{
+		Reference: uint16(reference), // CSMS reference number, must be the same for all SMS segments
+		Total:     m.Segments,
+	}
+	udh := pdutext.UDH{IEs: []pdutext.IE{concatenation}}
+	udh.Add(m.UDH.IEs...)
+	m.ESMClass |= UDHI // The short message begins with a user data header (UDH)
+
+	if v, ok := m.Text.(pdutext.GSM7National); ok {
+		// The national language shift tables are announced in the UDH.
+		udh.Add(v.Charset.IEs()...)
+	}
+
+	_, size := pdutext.Limits(m.Text, m.UDH)
+	segments, err := pdutext.SplitCodec(m.Text, size)
+	if err != nil {
+		return err
+	}
+
+	//
+
+	concatenation.Total = len(segments)
+	for i, segment := range segments {
+		concatenation.Sequence = i + 1
+		udh.Set(concatenation)
+
+		f := p.Fields()
+		f.Set(pdufield.ShortMessage, pdutext.Raw(pdutext.EncodeUserData(udh.Bytes(), segment)))
+		f.Set(pdufield.DataCoding, uint8(coding))
+		f.Set(pdufield.ESMClass, m.ESMClass) // UDH Indicator
+
+		if err := send(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CodingGroup returns true if the data_coding uses a GSM 03.38 coding group (message class or waiting indication).
+func (m *Message) CodingGroup() bool {
+	return m.Class != pdutext.ClassNone || m.Waiting != nil
+}
+
+// IsReplaceType returns true if the given protocol_id is a Replace Short Message Type (1 to 7).
+func IsReplaceType(pid uint8) bool {
+	return pid >= ProtocolIDReplace1 && pid <= ProtocolIDReplace7
+}
+
+// ProtocolIDString returns a human-readable description of the given protocol_id, or an empty string for the other values.
+func ProtocolIDString(pid uint8) string {
+	switch {
+	case pid == ProtocolIDSilent:
+		return "silent"
+	case IsReplaceType(pid):
+		return fmt.Sprintf("replace type %d", pid-ProtocolIDReplace1+1)
+	}
+	return ""
+}
+
+// Text returns the human-readable text of the short_message (or message_payload) of the given PDU.
+// It is decoded according to the data_coding and the UDH is stripped.
+// The alphabet tells how the texts using the SMSC default data_coding are coded.
+func Text(p pdu.Body, alphabet pdutext.DefaultAlphabet) (string, error) {
+	f := p.Fields()
+
+	var coding pdutext.DataCoding
+	if v := f[pdufield.DataCoding]; v != nil {
+		coding = pdutext.DataCoding(v.Bytes()[0])
+	}
+
+	var udhi bool
+	if v := f[pdufield.ESMClass]; v != nil {
+		udhi = v.Bytes()[0]&UDHI != 0
+	}
+
+	var sm []byte
+	if v := f[pdufield.ShortMessage]; v != nil {
+		sm = v.Bytes()
+	}
+	if v := p.TLVFields()[pdutlv.TagMessagePayload]; v != nil && len(sm) == 0 {
+		sm = v.Bytes()
+	}
+
+	return pdutext.DecodeShortMessage(coding, sm, udhi, alphabet)
+}
+
+// UserDataHeader returns the UDH of the short_message (or message_payload) of the given PDU.
+// The UDH is empty when the UDHI is not set in the esm_class.
+func UserDataHeader(p pdu.Body) (pdutext.UDH, error) {
+	f := p.Fields()
+
+	if v := f[pdufield.ESMClass]; v == nil || v.Bytes()[0]&UDHI == 0 {
+		return pdutext.UDH{}, nil
+	}
+
+	var sm []byte
+	if v := f[pdufield.ShortMessage]; v != nil {
+		sm = v.Bytes()
+	}
+	if v := p.TLVFields()[pdutlv.TagMessagePayload]; v != nil && len(sm) == 0 {
+		sm = v.Bytes()
+	}
+
+	return pdutext.ParseUDH(sm)
+}
+
+// MessageWaiting returns the message waiting indications of the given PDU
+// carried by the data_coding, the ms_msg_wait_facilities TLV and the UDH.
+func MessageWaiting(p pdu.Body) []pdutext.MessageWaiting {
+	var indications []pdutext.MessageWaiting
+
+	if v := p.Fields()[pdufield.DataCoding]; v != nil {
+		if mw, ok := pdutext.ParseMessageWaiting(pdutext.DataCoding(v.Bytes()[0])); ok {
+			indications = append(indications, mw)
+		}
+	}
+
+	if v := p.TLVFields()[pdutlv.TagMsMsgWaitFacilities]; v != nil && len(v.Bytes()) == 1 {
+		indications = append(indications, pdutext.ParseFacilities(v.Bytes()[0]))
+	}
+
+	if udh, err := UserDataHeader(p); err == nil {
+		for _, ie := range udh.SpecialSMSIndications() {
+			indications = append(indications, ie.MessageWaiting())
+		}
+	}
+
+	return indications
 }
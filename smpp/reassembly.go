@@ -0,0 +1,243 @@
+package smpp
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/mdouchement/basex"
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/pkg/errors"
+)
+
+type (
+	// A SegmentKey identifies a concatenated short message.
+	// The reference number alone is not enough because it is only unique per sender/recipient pair.
+	SegmentKey struct {
+		Src       string
+		Dst       string
+		Reference int
+		Total     int
+	}
+
+	// A Segment holds multi-segments metadata.
+	Segment struct {
+		Key                SegmentKey
+		ID                 string
+		RegisteredDelivery pdufield.DeliverySetting
+		Coding             pdutext.DataCoding
+		Charset            pdutext.Charset
+		Count              int
+		Completed          bool
+		Created            time.Time
+
+		parts map[int][]byte
+		ids   map[int]string
+		pdus  map[int]pdu.Body // Copies of the submit_sm of the parts, see Session.Forward
+	}
+
+	// A Reassembler stores the segments of concatenated short messages until they are complete.
+	// Duplicated and reordered segments are tolerated.
+	Reassembler struct {
+		mu       sync.Mutex
+		timeout  time.Duration
+		expired  func(*Segment)
+		messages map[SegmentKey]*Segment
+		done     chan struct{}
+		once     sync.Once
+	}
+)
+
+// Text returns the reassembled text of the message.
+// Missing parts are ignored.
+func (s *Segment) Text() string {
+	var b bytes.Buffer
+	for i := 1; i <= s.Key.Total; i++ {
+		b.Write(s.parts[i])
+	}
+
+	if pdutext.Alphabet(s.Coding) == pdutext.DefaultType {
+		return s.Charset.Decode(b.Bytes())
+	}
+	return pdutext.Decode(s.Coding, b.Bytes())
+}
+
+// SegmentID returns the message_id of the given part.
+func (s *Segment) SegmentID(seq int) string {
+	return s.ids[seq]
+}
+
+// SegmentIDs returns the message_id of each received part ordered by sequence number.
+func (s *Segment) SegmentIDs() []string {
+	ids := make([]string, 0, len(s.ids))
+	for i := 1; i <= s.Key.Total; i++ {
+		if id, ok := s.ids[i]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// PDUs returns the copies of the submit_sm of the received parts ordered by sequence number.
+func (s *Segment) PDUs() []pdu.Body {
+	pdus := make([]pdu.Body, 0, len(s.pdus))
+	for i := 1; i <= s.Key.Total; i++ {
+		if p, ok := s.pdus[i]; ok {
+			pdus = append(pdus, p)
+		}
+	}
+	return pdus
+}
+
+// Missing returns the sequence numbers of the parts not received yet.
+func (s *Segment) Missing() []int {
+	var missing []int
+	for i := 1; i <= s.Key.Total; i++ {
+		if _, ok := s.parts[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// NewReassembler returns a new Reassembler.
+// The expired callback is called with each message that is still incomplete after the given timeout
+// or when a new message reuses its reference.
+func NewReassembler(timeout time.Duration, expired func(*Segment)) *Reassembler {
+	r := &Reassembler{
+		timeout:  timeout,
+		expired:  expired,
+		messages: make(map[SegmentKey]*Segment),
+		done:     make(chan struct{}),
+	}
+
+	go r.janitor()
+	return r
+}
+
+// Add stores the given part of a concatenated message.
+// It returns the message the part belongs to and whether the part was already received.
+// A completed message is kept until the timeout so the late duplicates return its message_id,
+// a part with another content starts a new message reusing the reference.
+func (r *Reassembler) Add(key SegmentKey, seq int, coding pdutext.DataCoding, payload []byte) (*Segment, bool, error) {
+	if key.Total < 1 || seq < 1 || seq > key.Total {
+		return nil, false, errors.Errorf("invalid segment %d/%d", seq, key.Total)
+	}
+
+	segment, replaced, duplicate := r.add(key, seq, coding, payload)
+	if replaced != nil && r.expired != nil {
+		r.expired(replaced)
+	}
+	return segment, duplicate, nil
+}
+
+func (r *Reassembler) add(key SegmentKey, seq int, coding pdutext.DataCoding, payload []byte) (segment, replaced *Segment, duplicate bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	segment, ok := r.messages[key]
+	if ok {
+		part, received := segment.parts[seq]
+		if received {
+			if bytes.Equal(part, payload) {
+				return segment, nil, true
+			}
+
+			// Same reference reused by the sender for a new message.
+			if !segment.Completed {
+				replaced = segment
+			}
+			ok = false
+		}
+	}
+
+	if !ok {
+		segment = &Segment{
+			Key:     key,
+			ID:      basex.GenerateID(),
+			Coding:  coding,
+			Created: time.Now(),
+			parts:   make(map[int][]byte, key.Total),
+			ids:     make(map[int]string, key.Total),
+			pdus:    make(map[int]pdu.Body, key.Total),
+		}
+		r.messages[key] = segment
+	}
+
+	segment.parts[seq] = append([]byte(nil), payload...)
+	segment.ids[seq] = basex.GenerateID()
+	segment.Count = len(segment.parts)
+	segment.Completed = segment.Count == key.Total
+
+	return segment, replaced, false
+}
+
+// Remove forgets the given part of the message, e.g. when its submit_sm is rejected,
+// so it is not counted and its retry is not reported as a duplicate.
+func (r *Reassembler) Remove(segment *Segment, seq int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(segment.parts, seq)
+	delete(segment.ids, seq)
+	delete(segment.pdus, seq)
+	segment.Count = len(segment.parts)
+	segment.Completed = false
+
+	if current := r.messages[segment.Key]; segment.Count == 0 && current == segment {
+		delete(r.messages, segment.Key)
+	}
+}
+
+// Close stops the reassembler.
+func (r *Reassembler) Close() error {
+	r.once.Do(func() {
+		close(r.done)
+	})
+	return nil
+}
+
+func (r *Reassembler) janitor() {
+	tick := r.timeout / 10
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.expire()
+		}
+	}
+}
+
+func (r *Reassembler) expire() {
+	var expired []*Segment
+
+	r.mu.Lock()
+	for key, segment := range r.messages {
+		if time.Since(segment.Created) < r.timeout {
+			continue
+		}
+
+		delete(r.messages, key)
+		if !segment.Completed {
+			expired = append(expired, segment)
+		}
+	}
+	r.mu.Unlock()
+
+	if r.expired == nil {
+		return
+	}
+	for _, segment := range expired {
+		r.expired(segment)
+	}
+}
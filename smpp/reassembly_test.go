@@ -0,0 +1,108 @@
+package smpp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReassembler(t *testing.T) {
+	r := smpp.NewReassembler(time.Minute, nil)
+	defer r.Close()
+
+	key := smpp.SegmentKey{Src: "GOPHER", Dst: "33600000001", Reference: 42, Total: 3}
+
+	segment, duplicate, err := r.Add(key, 3, pdutext.UCS2Type, pdutext.UCS2("!").Encode())
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+	assert.False(t, segment.Completed)
+
+	_, _, err = r.Add(key, 4, pdutext.UCS2Type, nil)
+	assert.Error(t, err)
+
+	other, _, err := r.Add(smpp.SegmentKey{Src: "GOPHER", Dst: "33600000002", Reference: 42, Total: 3}, 1, pdutext.UCS2Type, nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, segment.ID, other.ID)
+
+	s, _, _ := r.Add(key, 1, pdutext.UCS2Type, pdutext.UCS2("Hello ").Encode())
+	assert.Equal(t, segment.ID, s.ID)
+
+	s, duplicate, _ = r.Add(key, 1, pdutext.UCS2Type, pdutext.UCS2("Hello ").Encode())
+	assert.True(t, duplicate)
+	assert.Equal(t, 2, s.Count)
+	assert.Equal(t, []int{2}, s.Missing())
+
+	s, _, _ = r.Add(key, 2, pdutext.UCS2Type, pdutext.UCS2("world").Encode())
+	assert.True(t, s.Completed)
+	assert.Equal(t, "Hello world!", s.Text())
+
+	// Late retransmission once completed.
+	s, duplicate, _ = r.Add(key, 1, pdutext.UCS2Type, pdutext.UCS2("Hello ").Encode())
+	assert.True(t, duplicate)
+	assert.Equal(t, segment.ID, s.ID)
+	assert.True(t, s.Completed)
+
+	// Same reference reused for a new message once completed.
+	s, duplicate, _ = r.Add(key, 1, pdutext.UCS2Type, pdutext.UCS2("Bye").Encode())
+	assert.False(t, duplicate)
+	assert.NotEqual(t, segment.ID, s.ID)
+	assert.Equal(t, 1, s.Count)
+}
+
+func TestReassembler_Replaced(t *testing.T) {
+	replaced := make(chan *smpp.Segment, 1)
+	r := smpp.NewReassembler(time.Minute, func(s *smpp.Segment) {
+		replaced <- s
+	})
+	defer r.Close()
+
+	key := smpp.SegmentKey{Src: "GOPHER", Dst: "33600000001", Reference: 42, Total: 2}
+	segment, _, _ := r.Add(key, 1, pdutext.UCS2Type, pdutext.UCS2("Hello ").Encode())
+
+	// Same reference reused with another content.
+	s, duplicate, _ := r.Add(key, 1, pdutext.UCS2Type, pdutext.UCS2("Bye").Encode())
+	assert.False(t, duplicate)
+	assert.NotEqual(t, segment.ID, s.ID)
+
+	select {
+	case s := <-replaced:
+		assert.Equal(t, segment.ID, s.ID)
+		assert.Equal(t, []int{2}, s.Missing())
+	default:
+		t.Fatal("replaced message not reported")
+	}
+
+	// A completed message is not reported when its reference is reused.
+	s, _, _ = r.Add(key, 2, pdutext.UCS2Type, nil)
+	assert.True(t, s.Completed)
+	_, duplicate, _ = r.Add(key, 1, pdutext.UCS2Type, pdutext.UCS2("Hello ").Encode())
+	assert.False(t, duplicate)
+
+	select {
+	case s := <-replaced:
+		t.Fatalf("completed message %s reported", s.ID)
+	default:
+	}
+}
+
+func TestReassembler_Expired(t *testing.T) {
+	expired := make(chan *smpp.Segment, 1)
+	r := smpp.NewReassembler(50*time.Millisecond, func(s *smpp.Segment) {
+		expired <- s
+	})
+	defer r.Close()
+
+	key := smpp.SegmentKey{Src: "GOPHER", Dst: "33600000001", Reference: 1, Total: 2}
+	segment, _, _ := r.Add(key, 2, pdutext.UCS2Type, nil)
+
+	select {
+	case s := <-expired:
+		assert.Equal(t, segment.ID, s.ID)
+		assert.Equal(t, []int{1}, s.Missing())
+	case <-time.After(time.Second):
+		t.Fatal("incomplete message not reported")
+	}
+}
@@ -1,9 +1,9 @@
 package smpp
 
 import (
-	"fmt"
 	"io"
 	"math/rand"
+	"regexp"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -16,6 +16,7 @@ import (
 	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
 	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
 	"github.com/mdouchement/smsc3/address"
+	"github.com/mdouchement/smsc3/dlr"
 	"github.com/mdouchement/smsc3/pdutext"
 	"github.com/pkg/errors"
 )
@@ -23,28 +24,71 @@ import (
 // UDHI is the User Data Header Indicator used in esm_class.
 const UDHI = 0b0100_0000
 
-type (
-	// A Session is a SMPP session.
-	Session struct {
-		mu        sync.Mutex
-		rnd       *rand.Rand
-		log       logger.Logger
-		c         *Connection
-		sequences cache.Cache
-		segments  cache.Cache
-		systemID  string
-		sequence  uint32
-	}
-
-	// A Segment holds multi-segments metadata.
-	Segment struct {
-		ID                 string
-		RegisteredDelivery pdufield.DeliverySetting
-		Count              int
-		Completed          bool
-	}
+// A Submitted is a short message submitted by the ESME, reassembled when it is a multipart message.
+type Submitted struct {
+	ID         string
+	Src        string
+	Dst        string
+	Text       string
+	ProtocolID uint8
+	Coding     pdutext.DataCoding
+
+	p        pdu.Body
+	parts    []pdu.Body // submit_sm of each segment
+	alphabet pdutext.DefaultAlphabet
+	ids      []string // message_ids reported in the DLRs
+	silent   bool     // DLRs suppressed by the hook, see Hook.SubmitSM
+}
+
+var (
+	// ErrNotHeld is returned when a DLR is triggered for a message that is not held, see Session.SendDLR.
+	ErrNotHeld = errors.New("no DLR held for this message")
+	// ErrNotRequested is returned when a DLR is triggered with an outcome whose DLR was not requested by
+	// the registered_delivery of the message (success only), see Session.SendDLR.
+	ErrNotRequested = errors.New("DLR not requested for this outcome")
 )
 
+// A heldDLR is a DLR held until it is triggered.
+type heldDLR struct {
+	p         pdu.Body // Copy of the submit_sm, the received one being reused
+	text      string   // Text of the whole message
+	rd        uint8    // registered_delivery of the message, see Session.dlr
+	submitted time.Time
+}
+
+// A Hook alters how a session handles the PDUs sent by the ESME.
+type Hook interface {
+	// SubmitSM is called with each submit_sm, including its message_id.
+	// It returns the command_status of the submit_sm_resp and whether the DLRs are sent.
+	// A rejected submit_sm is neither delivered nor acknowledged by a DLR, and a rejected segment can be retried.
+	SubmitSM(s *Session, p pdu.Body) (status pdu.Status, dlr bool)
+	// DeliverSMResp is called with each deliver_sm_resp.
+	DeliverSMResp(s *Session, p pdu.Body)
+}
+
+// A Session is a SMPP session.
+type Session struct {
+	mu          sync.Mutex
+	rnd         *rand.Rand
+	log         logger.Logger
+	c           *Connection
+	sequences   cache.Cache
+	held        cache.Cache // DLRs held in manual mode by message_id
+	segments    *Reassembler
+	dialogs     *Dialogs
+	submitted   func(Submitted) bool
+	dlrSent     func(pdu.Body)
+	addresses   *regexp.Regexp // address_range of the bind
+	transmitter bool           // Bound with bind_transmitter, see SetTransmitter
+	hook        Hook
+	handler     Handler
+	account     *Account
+	systemID    string
+	sequence    uint32
+	listening   bool
+	unbound     chan struct{} // Closed on unbind_resp when listening
+}
+
 // ConvertValidity convert a duration to an Absolute time format.
 func ConvertValidity(d time.Duration) string {
 	validity := time.Now().UTC().Add(d)
@@ -53,25 +97,40 @@ func ConvertValidity(d time.Duration) string {
 }
 
 // NewSession returns a new Session.
-func NewSession(l logger.Logger, c *Connection, systemID string) *Session {
-	return &Session{
+func NewSession(l logger.Logger, c *Connection, account *Account) *Session {
+	s := &Session{
 		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
 		log:      l,
 		c:        c,
-		systemID: systemID,
+		account:  account,
+		systemID: account.SystemID,
+		dialogs:  NewDialogs(10 * time.Minute),
+		handler:  NewServeMux(),
+		unbound:  make(chan struct{}),
 		sequences: cache.New(
 			cache.WithMaximumSize(4096<<20), // 4 MiB
 			cache.WithExpireAfterWrite(10*time.Minute),
 		),
-		segments: cache.New(
-			cache.WithMaximumSize(4096<<20), // 4 MiB
-			cache.WithExpireAfterWrite(10*time.Minute),
+		held: cache.New(
+			cache.WithMaximumSize(100_000),
+			cache.WithExpireAfterWrite(24*time.Hour),
 		),
 	}
+	c.Alphabet = account.Alphabet()
+	s.segments = NewReassembler(10*time.Minute, func(segment *Segment) {
+		s.log.Warnf("Incomplete multipart message %s from %s to %s (ref %d): received %d/%d segments, missing %v",
+			segment.ID, segment.Key.Src, segment.Key.Dst, segment.Key.Reference, segment.Count, segment.Key.Total, segment.Missing())
+	})
+
+	return s
 }
 
 // Listen reads the connection and handles read PDUs.
 func (s *Session) Listen() error {
+	s.mu.Lock()
+	s.listening = true
+	s.mu.Unlock()
+
 	for {
 		p, err := s.c.Decode()
 		if err != nil {
@@ -83,47 +142,8 @@ func (s *Session) Listen() error {
 			continue // Ignoring error
 		}
 
-		// Supported SMPP commands
-		var r pdu.Body
-		switch p.Header().ID {
-		case pdu.EnquireLinkID:
-			// Ping / Heartbeat
-			r = pdu.NewEnquireLinkRespSeq(p.Header().Seq)
-		case pdu.DeliverSMRespID:
-			// Ack of a sent SMS/DLR from SMSC to ESME
-			s.log.Infof("ACK sms/dlr")
-			s.AddPDU(p)
-		case pdu.SubmitSMID:
-			// Receiving SMS from ESME to SMSC
-
-			id, segment, err := s.handleSegments(p)
-			if err != nil {
-				s.log.WithError(err).Error("Could not handle submit_sm segments")
-			}
-
-			if segment == nil || segment.Completed {
-				p.Fields().Set(pdufield.MessageID, id)
-				if segment != nil {
-					p.Fields().Set(pdufield.RegisteredDelivery, segment.RegisteredDelivery)
-				}
-				s.DLRs(p)
-			}
-
-			r = pdu.NewSubmitSMRespSeq(p.Header().Seq)
-			r.Fields().Set(pdufield.MessageID, id)
-		case pdu.UnbindID:
-			// End of session asked by ESME
-			s.log.Infof("Unbinding session %s", s.systemID)
-			r = pdu.NewUnbindRespSeq(p.Header().Seq)
-		case pdu.UnbindRespID:
-			// End of session asked by SMSC
-			s.log.Infof("Unbinded session %s", s.systemID)
-		case pdu.GenericNACKID:
-			s.log.Warn(p.Header().Status.Error())
-		default:
-			r = pdu.NewGenericNACK()
-			r.Header().Status = 0x00000003 // Invalid Command ID
-		}
+		// Supported SMPP commands, see ServeMux
+		r := s.Handler().ServeSMPP(s, p)
 
 		if r != nil {
 			if err = s.c.Serialize(r); err != nil {
@@ -132,6 +152,17 @@ func (s *Session) Listen() error {
 			}
 		}
 
+		// Unbind asked by the SMSC, see Close
+		if p.Header().ID == pdu.UnbindRespID {
+			s.mu.Lock()
+			select {
+			case <-s.unbound:
+			default:
+				close(s.unbound)
+			}
+			s.mu.Unlock()
+		}
+
 		// Stop the session
 		if p.Header().ID == pdu.UnbindID {
 			s.c.log.Infof("Closing session %s", s.systemID)
@@ -145,14 +176,215 @@ func (s *Session) Listen() error {
 				return err
 			}
 
+			if err = s.held.Close(); err != nil {
+				return err
+			}
+
 			return s.sequences.Close()
 		}
 	}
 }
 
+// OnSubmit registers the function called with each short message submitted by the ESME.
+// A multipart message is given once all its segments are received.
+// When fn returns true, the message is routed elsewhere and its DLRs are sent by the caller with Receipt.
+func (s *Session) OnSubmit(fn func(Submitted) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.submitted = fn
+}
+
+func (s *Session) submit(id string, ids []string, p pdu.Body, segment *Segment, receipt bool) bool {
+	s.mu.Lock()
+	fn := s.submitted
+	s.mu.Unlock()
+	if fn == nil {
+		return false
+	}
+
+	f := p.Fields()
+	m := Submitted{
+		ID:       id,
+		Src:      international(f[pdufield.SourceAddr], f[pdufield.SourceAddrTON]),
+		Dst:      international(f[pdufield.DestinationAddr], f[pdufield.DestAddrTON]),
+		p:        p,
+		parts:    []pdu.Body{p},
+		alphabet: s.c.Alphabet,
+		ids:      ids,
+		silent:   !receipt,
+	}
+	if v := f[pdufield.ProtocolID]; v != nil {
+		m.ProtocolID = v.Bytes()[0]
+	}
+	if v := f[pdufield.DataCoding]; v != nil {
+		m.Coding = pdutext.DataCoding(v.Bytes()[0])
+	}
+
+	m.Text = s.text(p, segment)
+	if segment != nil {
+		m.parts = segment.PDUs()
+	}
+
+	return fn(m)
+}
+
+// text returns the text of the given submit_sm, the reassembled one when it belongs to a multipart message.
+func (s *Session) text(p pdu.Body, segment *Segment) string {
+	if segment != nil {
+		return segment.Text()
+	}
+
+	text, err := Text(p, s.c.Alphabet)
+	if err != nil {
+		s.log.WithError(err).Error("Could not decode submitted message")
+	}
+	return text
+}
+
+// international returns the given address with the international prefix when its TON is international.
+func international(addr, ton pdufield.Body) string {
+	if addr == nil {
+		return ""
+	}
+
+	v := addr.String()
+	if ton != nil && ton.Bytes()[0] == 0x01 && !strings.HasPrefix(v, "+") {
+		return "+" + v
+	}
+	return v
+}
+
+// OnDLR registers the function called with each DLR sent to the ESME.
+func (s *Session) OnDLR(fn func(dlr pdu.Body)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dlrSent = fn
+}
+
+// Receipt sends the DLRs of the given submitted message according to its delivery outcome.
+// A nil error reports a delivered message, otherwise an undeliverable message whose err is the pdu.Status, if any.
+// Nothing is sent when the DLRs were suppressed by the hook.
+func (s *Session) Receipt(m Submitted, err error) {
+	if m.silent {
+		return
+	}
+
+	outcome := dlr.Outcome{State: dlr.Delivered, Network: dlr.NetworkGSM}
+	if err != nil {
+		var code pdu.Status
+		errors.As(err, &code)
+		outcome.State, outcome.Err = dlr.Undeliverable, int(code)
+	}
+
+	for _, id := range m.ids {
+		m.p.Fields().Set(pdufield.MessageID, id)
+		s.dlr(m.p, m.Text, outcome)
+	}
+}
+
+// SetTransmitter marks the session as bound with bind_transmitter: the ESME can not receive messages (MO).
+func (s *Session) SetTransmitter(transmitter bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.transmitter = transmitter
+}
+
+// Transmitter returns true if the session is bound with bind_transmitter.
+func (s *Session) Transmitter() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.transmitter
+}
+
+// SetAddressRange sets the address_range given by the ESME in the bind PDU, as a regular expression.
+// An empty address_range matches no address.
+func (s *Session) SetAddressRange(addressRange string) (err error) {
+	var re *regexp.Regexp
+	if addressRange != "" {
+		re, err = regexp.Compile(addressRange)
+		if err != nil {
+			return errors.Wrap(err, "invalid address_range")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addresses = re
+	return nil
+}
+
+// HasAddressRange returns true if the ESME has given an address_range in the bind PDU.
+func (s *Session) HasAddressRange() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addresses != nil
+}
+
+// InAddressRange returns true if the given address matches the address_range of the session,
+// as given or as formatted in the deliver_sm, with or without its international prefix.
+func (s *Session) InAddressRange(addr string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.addresses == nil {
+		return false
+	}
+
+	for _, v := range []string{addr, address.Parse(addr).String()} {
+		if s.addresses.MatchString(v) || s.addresses.MatchString(strings.TrimPrefix(v, "+")) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetHandler sets the handler of the PDUs sent by the ESME, a ServeMux with the default handlers by default.
+func (s *Session) SetHandler(h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handler = h
+}
+
+// Handler returns the handler of the PDUs sent by the ESME.
+func (s *Session) Handler() Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.handler
+}
+
+// SetHook sets the hook called on the PDUs sent by the ESME.
+func (s *Session) SetHook(hook Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hook = hook
+}
+
+// Hook returns the hook of the session, if any.
+func (s *Session) Hook() Hook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.hook
+}
+
+// Account returns the account used to bind the session.
+func (s *Session) Account() *Account {
+	return s.account
+}
+
 // Close closes the session.
 func (s *Session) Close() error {
 	s.c.log.Infof("Closing session %s", s.systemID)
+	s.c.SetDeadline(time.Now().Add(5 * time.Second)) // The ESME may not answer
 
 	p := pdu.NewUnbind()
 	err := s.c.Serialize(p)
@@ -160,8 +392,17 @@ func (s *Session) Close() error {
 		return err
 	}
 
-	_, err = s.c.Decode() // unbind_resp
-	if err != nil {
+	s.mu.Lock()
+	listening := s.listening
+	s.mu.Unlock()
+
+	if listening {
+		// The unbind_resp is read by Listen
+		select {
+		case <-s.unbound:
+		case <-time.After(5 * time.Second): // The ESME may not answer
+		}
+	} else if _, err = s.c.Decode(); err != nil { // unbind_resp
 		return err
 	}
 
@@ -174,6 +415,10 @@ func (s *Session) Close() error {
 		return err
 	}
 
+	if err = s.held.Close(); err != nil {
+		return err
+	}
+
 	return s.sequences.Close()
 }
 
@@ -199,217 +444,325 @@ func (s *Session) PDU(sequence uint32) pdu.Body {
 
 // Send send the SMS to the session.
 func (s *Session) Send(m *Message, p pdu.Body) error {
-	send := s.single
-	if m.Segments > 1 {
-		send = s.multipart
+	m.Text = s.account.Codec(m.Text, m.CodingGroup())
+	err := m.Encode(p, s.csmsReference8(), func(p pdu.Body) error {
+		p.Header().Seq = atomic.AddUint32(&s.sequence, 1)
+		return s.c.Serialize(p)
+	})
+	if err != nil {
+		return err
 	}
 
-	s.defaults(m, p)
-	err := send(m, p)
+	// Wait for PDU response in order to ACK the request
+	r, err := s.response(p.Header().Seq)
 	if err != nil {
 		return err
 	}
 
-	// Wait for PDU response in order to ACK the request
+	if r.Header().Status == 0 {
+		return nil
+	}
+
+	return r.Header().Status
+}
+
+// Forward delivers the given message submitted by another ESME as is: the short_message, data_coding,
+// esm_class (UDH), protocol_id and TLVs of each of its segments are kept. Only a text using the SMSC default alphabet
+// is adapted to the alphabet of the account. It returns the status of the first rejected segment, if any.
+func (s *Session) Forward(m Submitted) error {
+	for _, part := range m.parts {
+		src := part.Fields()
+
+		p := pdu.NewDeliverSM()
+		f := p.Fields()
+		for _, name := range []pdufield.Name{
+			pdufield.SourceAddrTON, pdufield.SourceAddrNPI, pdufield.SourceAddr,
+			pdufield.DestAddrTON, pdufield.DestAddrNPI, pdufield.DestinationAddr,
+			pdufield.ProtocolID, pdufield.PriorityFlag, pdufield.DataCoding, pdufield.ShortMessage,
+		} {
+			if v := src[name]; v != nil {
+				f[name] = v
+			}
+		}
+		for k, v := range part.TLVFields() {
+			p.TLVFields()[k] = v
+		}
+
+		var esmclass, coding uint8
+		if v := src[pdufield.ESMClass]; v != nil && len(v.Bytes()) > 0 {
+			esmclass = v.Bytes()[0] & (UDHI | 0b1000_0000) // GSM features (UDHI, reply path), the rest is specific to submit_sm
+		}
+		f.Set(pdufield.ESMClass, esmclass)
+		if v := src[pdufield.DataCoding]; v != nil && len(v.Bytes()) > 0 {
+			coding = v.Bytes()[0]
+		}
+		if v := src[pdufield.ShortMessage]; v != nil {
+			sm, err := pdutext.Recode(pdutext.DataCoding(coding), v.Bytes(), esmclass&UDHI != 0, m.alphabet, s.c.Alphabet)
+			if err != nil {
+				return err
+			}
+			f.Set(pdufield.ShortMessage, sm) // Not a pdutext.Codec, which would reset the data_coding
+		}
+
+		p.Header().Seq = atomic.AddUint32(&s.sequence, 1)
+		if err := s.c.Serialize(p); err != nil {
+			return err
+		}
+
+		r, err := s.response(p.Header().Seq)
+		if err != nil {
+			return err
+		}
+		if r.Header().Status != 0 {
+			return r.Header().Status
+		}
+	}
+	return nil
+}
+
+// response waits for the response of the PDU sent with the given sequence.
+func (s *Session) response(sequence uint32) (pdu.Body, error) {
 	start := time.Now()
 	for {
 		time.Sleep(250 * time.Millisecond)
-		r := s.PDU(p.Header().Seq)
+		r := s.PDU(sequence)
 		if r == nil {
 			if time.Since(start) > 10*time.Second {
-				return errors.New("timeout")
+				return nil, errors.New("timeout")
 			}
 
 			continue
 		}
 
-		if r.Header().Status == 0 {
-			return nil
-		}
-
-		return errors.New(r.Header().Status.Error())
+		return r, nil
 	}
 }
 
-func (s *Session) defaults(m *Message, p pdu.Body) {
+func (s *Session) handleSegments(p pdu.Body) (id string, segment *Segment, seq int, duplicate bool, err error) {
 	f := p.Fields()
 
-	src := address.Parse(m.Src)
-	f.Set(pdufield.SourceAddr, src.String())
-	f.Set(pdufield.SourceAddrTON, src.TON())
-	f.Set(pdufield.SourceAddrNPI, src.NPI())
-
-	dst := address.Parse(m.Dst)
-	f.Set(pdufield.DestinationAddr, dst.String())
-	f.Set(pdufield.DestAddrTON, dst.TON())
-	f.Set(pdufield.DestAddrNPI, dst.NPI())
-
-	f.Set(pdufield.RegisteredDelivery, uint8(m.Register))
-	// Check if the message has validity set.
-	if m.Validity != time.Duration(0) {
-		f.Set(pdufield.ValidityPeriod, ConvertValidity(m.Validity))
+	esmclass, ok := f[pdufield.ESMClass]
+	if !ok || esmclass == nil {
+		return basex.GenerateID(), nil, 0, false, nil
 	}
-	f.Set(pdufield.ServiceType, m.ServiceType)
-	f.Set(pdufield.ESMClass, m.ESMClass)
-	f.Set(pdufield.ProtocolID, m.ProtocolID)
-	f.Set(pdufield.PriorityFlag, m.PriorityFlag)
-	f.Set(pdufield.ScheduleDeliveryTime, m.ScheduleDeliveryTime)
-	f.Set(pdufield.ReplaceIfPresentFlag, m.ReplaceIfPresentFlag)
-	f.Set(pdufield.SMDefaultMsgID, m.SMDefaultMsgID)
 
-	tlv := p.TLVFields()
-	for f, b := range m.TLVFields {
-		tlv.Set(f, b)
+	if esmclass.Bytes()[0]&UDHI == 0 {
+		return basex.GenerateID(), nil, 0, false, nil
 	}
-}
-
-func (s *Session) single(m *Message, p pdu.Body) error {
-	f := p.Fields()
-	f.Set(pdufield.ShortMessage, m.Text)
 
-	p.Header().Seq = atomic.AddUint32(&s.sequence, 1)
-	return s.c.Serialize(p)
-}
-
-func (s *Session) multipart(m *Message, p pdu.Body) error {
-	csms := s.csmsReference8()
-	udh := []byte{
-		5,                // UDH length
-		0,                // Length of CSMS identifier, CSMS 8 bit reference number
-		3,                // Length of the header, excluding first two fields
-		byte(csms),       // CSMS reference number, must be the same for all SMS segments
-		byte(m.Segments), // Total parts
-		0,                // Part number (default value)
+	sm := f[pdufield.ShortMessage].Bytes()
+	udh, err := pdutext.ParseUDH(sm)
+	if err != nil {
+		return basex.GenerateID(), nil, 0, false, err
 	}
-	m.ESMClass |= UDHI // The short message begins with a user data header (UDH)
-
-	//
 
-	var segments []string
-	var codec func(s string) pdutext.Codec
-
-	// Content aware splitting
-	switch v := m.Text.(type) {
-	case pdutext.GSM7Packed:
-		segments = pdutext.Split(string(v), pdutext.SizeGSM7Multipart)
-		codec = func(s string) pdutext.Codec {
-			return pdutext.GSM7Packed(s)
-		}
-	case pdutext.UCS2:
-		segments = pdutext.Split(string(v), pdutext.SizeUCS2Multipart)
-		codec = func(s string) pdutext.Codec {
-			return pdutext.UCS2(s)
-		}
-	default:
-		return errors.Errorf("unsupported message codec: %T", v)
+	concatenation, ok := udh.Concatenation()
+	if !ok {
+		// Not a concatenated short message (e.g. national language shift tables only).
+		return basex.GenerateID(), nil, 0, false, nil
 	}
 
 	//
 
-	for i, segment := range segments {
-		udh[len(udh)-1] = byte(i + 1) // Set part number
-
-		f := p.Fields()
-		f.Set(pdufield.ShortMessage, pdutext.Raw(append(udh, codec(segment).Encode()...)))
-		f.Set(pdufield.DataCoding, uint8(m.Text.Type()))
-		f.Set(pdufield.ESMClass, m.ESMClass) // UDH Indicator
-
-		p.Header().Seq = atomic.AddUint32(&s.sequence, 1)
-		if err := s.c.Serialize(p); err != nil {
-			return err
-		}
+	var coding pdutext.DataCoding
+	if dc, ok := f[pdufield.DataCoding]; ok && dc != nil {
+		coding = pdutext.DataCoding(dc.Bytes()[0])
 	}
 
-	return nil
-}
-
-func (s *Session) handleSegments(p pdu.Body) (string, *Segment, error) {
-	esmclass, ok := p.Fields()[pdufield.ESMClass]
-	if !ok && esmclass == nil {
-		return basex.GenerateID(), nil, nil
+	key := SegmentKey{
+		Src:       f[pdufield.SourceAddr].String(),
+		Dst:       f[pdufield.DestinationAddr].String(),
+		Reference: int(concatenation.Reference),
+		Total:     concatenation.Total,
 	}
 
-	if esmclass.Bytes()[0]&UDHI == 0 {
-		return basex.GenerateID(), nil, nil
+	payload := sm[udh.Len():]
+	if pdutext.Alphabet(coding) == pdutext.DefaultType && s.account.Packed() {
+		// Stored unpacked so the segments can be concatenated.
+		payload = pdutext.UnpackWithUDH(payload, udh.Len())
 	}
 
-	udh, err := pdutext.ParseUDH(p.Fields()[pdufield.ShortMessage].Bytes())
+	segment, duplicate, err = s.segments.Add(key, concatenation.Sequence, coding, payload)
 	if err != nil {
-		return basex.GenerateID(), nil, err
+		return basex.GenerateID(), nil, 0, false, err
 	}
 
-	//
-
-	var segment *Segment
-
-	v, ok := s.segments.GetIfPresent(udh.ID)
-	if ok {
-		segment = v.(*Segment)
+	segment.Charset = udh.Charset()
+	if !duplicate {
+		segment.pdus[concatenation.Sequence] = clone(p)
 	}
 
-	if segment == nil {
-		segment = &Segment{
-			ID:    basex.GenerateID(),
-			Count: 0,
-		}
+	if duplicate {
+		s.log.Warnf("Duplicated segment %d/%d of multipart message %s", concatenation.Sequence, concatenation.Total, segment.ID)
 	}
 
-	segment.Count++
-	segment.Completed = segment.Count == udh.Segments
-
 	// Only the first segment contains the registry_delivery information.
-	delivery, ok := p.Fields()[pdufield.RegisteredDelivery]
+	delivery, ok := f[pdufield.RegisteredDelivery]
 	if ok && delivery != nil {
 		segment.RegisteredDelivery |= pdufield.DeliverySetting(delivery.Bytes()[0])
 	}
 
-	s.segments.Put(udh.ID, segment)
-	return segment.ID, segment, err
+	id = segment.ID
+	if s.account.PerSegment() {
+		id = segment.SegmentID(concatenation.Sequence)
+	}
+
+	return id, segment, concatenation.Sequence, duplicate, nil
 }
 
 // DLRs generates and sends the DLRs for the given received SMS.
 // https://smpp.org/smpp-delivery-receipt.html
 // https://smpp.io/dlr-receipt/
 // https://github.com/pruiz/kannel/blob/master/gw/smsc/smsc_smpp.c
-func (s *Session) DLRs(p pdu.Body) {
-	go func() {
-		field := p.Fields()[pdufield.RegisteredDelivery]
-		if field == nil {
+// The outcome is decided by the DLR outcome rules of the account, delivered by default.
+// The text is the one of the whole message, reported by the DLR templates with text.
+func (s *Session) DLRs(p pdu.Body, text string) {
+	// DELIVERED (2) ; Kannel's %d the delivery report value (dlr 1)
+	f := p.Fields()
+	s.dlr(p, text, s.account.Outcome(international(f[pdufield.DestinationAddr], f[pdufield.DestAddrTON])))
+}
+
+func (s *Session) dlr(p pdu.Body, text string, outcome dlr.Outcome) {
+	field := p.Fields()[pdufield.RegisteredDelivery]
+	if field == nil {
+		return
+	}
+
+	rd := field.Bytes()[0]
+	rd &= 0b0000_0011 // Ignore 0bxxx1xxxx that may be provided for intermediate notification.
+
+	switch rd {
+	case 0:
+		// No MC Delivery Receipt requested
+	case 1, 2:
+		// 1: MC Delivery Receipt requested where final delivery outcome is delivery success or failure
+		// 2: MC Delivery Receipt requested where the final delivery outcome is success
+		if s.account.ManualDLR() {
+			s.hold(p, text, rd) // The outcome is given when the DLR is triggered
 			return
 		}
 
-		rd := field.Bytes()[0]
-		rd &= 0b0000_0011 // Ignore 0bxxx1xxxx that may be provided for intermediate notification.
+		if rd == 2 && outcome.State != dlr.Delivered {
+			return
+		}
 
-		switch rd {
-		case 0:
-			// No MC Delivery Receipt requested
-		case 1:
-			// MC Delivery Receipt requested where final delivery outcome is delivery success or failure
+		s.schedule(p, text, outcome, time.Second)
+	}
+}
 
-			// DELIVERED (2) ; Kannel's %d the delivery report value (dlr 1)
-			dlr := createDLR(p, 2)
-			time.Sleep(time.Second)
-			err := s.c.Serialize(dlr)
-			if err != nil {
-				s.log.WithError(err).Error("Could not send DLR")
-			}
-			s.log.Infof("DLR DELIVERED (%d)", dlr.Header().Seq)
-		case 2:
-			// MC Delivery Receipt requested where the final delivery outcome is success
-
-			// DELIVERED (2) ; Kannel's %d the delivery report value (dlr 1)
-			dlr := createDLR(p, 2)
-			time.Sleep(time.Second)
-			err := s.c.Serialize(dlr)
-			if err != nil {
-				s.log.WithError(err).Error("Could not send DLR")
-			}
-			s.log.Infof("DLR DELIVERED (%d)", dlr.Header().Seq)
+// DLR sends a DLR reporting the given outcome for the given submit_sm after the delay,
+// whatever its registered_delivery. The error code is reported for a failed message only.
+func (s *Session) DLR(p pdu.Body, outcome dlr.Outcome, delay time.Duration) error {
+	if !outcome.State.Valid() {
+		return errors.Errorf("invalid DLR state %d", outcome.State)
+	}
+
+	s.schedule(p, s.text(p, nil), outcome, delay)
+	return nil
+}
+
+// schedule sends a DLR reporting the given outcome for the given submit_sm after the delay.
+func (s *Session) schedule(p pdu.Body, text string, outcome dlr.Outcome, delay time.Duration) {
+	// The DLR is crafted right now because the given PDU may be reused by the caller.
+	now := time.Now()
+	receipt := s.createDLR(p, text, outcome, now, now)
+	go func() {
+		time.Sleep(delay)
+		if err := s.sendDLR(receipt, outcome); err != nil {
+			s.log.WithError(err).Error("Could not send DLR")
 		}
 	}()
 }
 
+// hold holds the DLR of the given submit_sm until it is triggered by SendDLR.
+func (s *Session) hold(p pdu.Body, text string, rd uint8) {
+	h := heldDLR{
+		p:         clone(p),
+		text:      text,
+		rd:        rd,
+		submitted: time.Now(),
+	}
+
+	id := p.Fields()[pdufield.MessageID].String()
+	s.held.Put(id, h)
+	s.log.Infof("Holding DLR of %s", id)
+}
+
+// clone returns a copy of the given submit_sm, the received PDUs being reused.
+func clone(p pdu.Body) pdu.Body {
+	c := pdu.NewSubmitSM(nil)
+	for k, v := range p.Fields() {
+		c.Fields()[k] = v
+	}
+	for k, v := range p.TLVFields() {
+		c.TLVFields()[k] = v
+	}
+	return c
+}
+
+// Held returns true if a DLR is held for the given message_id.
+func (s *Session) Held(id string) bool {
+	_, ok := s.held.GetIfPresent(id)
+	return ok
+}
+
+// SendDLR sends the held DLR of the given message_id with the given outcome and done date, now when zero.
+// It returns the command_status of the deliver_sm_resp of the ESME.
+// The message is released by a final DLR, an intermediate one (ENROUTE or ACCEPTD) can be followed by another DLR.
+// ErrNotRequested is returned when only a success DLR was requested and the outcome is not delivered,
+// the message being released by a final outcome.
+func (s *Session) SendDLR(id string, outcome dlr.Outcome, done time.Time) (pdu.Status, error) {
+	if !outcome.State.Valid() {
+		return 0, errors.Errorf("invalid DLR state %d", outcome.State)
+	}
+
+	v, ok := s.held.GetIfPresent(id)
+	if !ok {
+		return 0, ErrNotHeld
+	}
+	h := v.(heldDLR)
+
+	if h.rd == 2 && outcome.State != dlr.Delivered {
+		if !outcome.State.Intermediate() {
+			s.held.Invalidate(id)
+		}
+		return 0, ErrNotRequested
+	}
+
+	if done.IsZero() {
+		done = time.Now()
+	}
+	receipt := s.createDLR(h.p, h.text, outcome, h.submitted, done)
+	if err := s.sendDLR(receipt, outcome); err != nil {
+		return 0, errors.Wrap(err, "could not send DLR")
+	}
+
+	r, err := s.response(receipt.Header().Seq)
+	if err != nil {
+		return 0, err
+	}
+	if !outcome.State.Intermediate() {
+		s.held.Invalidate(id)
+	}
+	return r.Header().Status, nil
+}
+
+func (s *Session) sendDLR(receipt pdu.Body, outcome dlr.Outcome) error {
+	receipt.Header().Seq = atomic.AddUint32(&s.sequence, 1) // Correlates its deliver_sm_resp with the other sent PDUs
+	if err := s.c.Serialize(receipt); err != nil {
+		return err
+	}
+	s.log.Infof("DLR %s (%d)", outcome.State, receipt.Header().Seq)
+
+	s.mu.Lock()
+	fn := s.dlrSent
+	s.mu.Unlock()
+	if fn != nil {
+		fn(receipt)
+	}
+	return nil
+}
+
 func (s *Session) csmsReference8() uint8 {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -424,12 +777,12 @@ func (s *Session) csmsReference16() uint16 {
 
 // Several ways to craft a DLR:
 // esm_class + short_message + receipted_message_id
-func createDLR(p pdu.Body, state int) pdu.Body {
+func (s *Session) createDLR(p pdu.Body, text string, outcome dlr.Outcome, submitted, done time.Time) pdu.Body {
 	src := p.Fields()
 	id := src[pdufield.MessageID].String()
 
-	dlr := pdu.NewDeliverSM()
-	f := dlr.Fields()
+	d := pdu.NewDeliverSM()
+	f := d.Fields()
 
 	f.Set(pdufield.SourceAddr, src[pdufield.DestinationAddr])
 	f.Set(pdufield.SourceAddrTON, src[pdufield.DestAddrTON])
@@ -439,38 +792,47 @@ func createDLR(p pdu.Body, state int) pdu.Body {
 	f.Set(pdufield.DestAddrTON, src[pdufield.SourceAddrTON])
 	f.Set(pdufield.DestAddrNPI, src[pdufield.SourceAddrNPI])
 
-	var msg string
-	date := time.Now().Format("0601021504")
-	switch state {
-	case 1:
-		msg = "id:%s sub:001 dlvrd:000 submit date:%s done date:%s stat:ENROUTE err:000"
-		msg = fmt.Sprintf(msg, id, date, date)
+	template := s.account.Template()
 
-		// SMPP Protocol Specification v3.4
-		// 5.2.12 esm_class
-		f.Set(pdufield.ESMClass, 0b100000) // Temporary DLR
-	case 6:
-		msg = "id:%s sub:001 dlvrd:000 submit date:%s done date:%s stat:ACCEPTD err:000"
-		msg = fmt.Sprintf(msg, id, date, date)
+	receipt := dlr.Receipt{
+		ID:         id,
+		Sub:        1,
+		SubmitDate: submitted,
+		DoneDate:   done,
+		Stat:       outcome.State.Stat(),
+	}
+	if outcome.State == dlr.Delivered {
+		receipt.Dlvrd = 1
+	}
+	if outcome.Failed() {
+		receipt.Err = outcome.Err
+	}
+	if template.Text {
+		receipt.Text = text
+	}
 
-		// SMPP Protocol Specification v3.4
-		// 5.2.12 esm_class
+	// SMPP Protocol Specification v3.4
+	// 5.2.12 esm_class
+	f.Set(pdufield.ESMClass, 0b100) // Final DLR
+	if outcome.State.Intermediate() {
 		f.Set(pdufield.ESMClass, 0b100000) // Temporary DLR
-	case 2:
-		msg = "id:%s sub:001 dlvrd:001 submit date:%s done date:%s stat:DELIVRD err:000"
-		msg = fmt.Sprintf(msg, id, date, date)
-
-		// SMPP Protocol Specification v3.4
-		// 5.2.12 esm_class
-		f.Set(pdufield.ESMClass, 0b100) // Final DLR
-	default:
-		panic("invalid state")
 	}
-	sm, _, _ := pdutext.SelectCodec(msg)
-	f.Set(pdufield.ShortMessage, sm)
 
-	tlv := dlr.TLVFields()
-	tlv.Set(pdutlv.TagReceiptedMessageID, pdutlv.CString(id))
+	// Always in the default alphabet, parsed as is by most ESMEs.
+	sm := pdutext.GSM7(pdutext.ReplaceNonGSM7(template.Format(receipt), '?'))
+	f.Set(pdufield.ShortMessage, s.account.Codec(sm, false))
+
+	tlv := d.TLVFields()
+	if template.Has(dlr.TLVReceiptedMessageID) {
+		tlv.Set(pdutlv.TagReceiptedMessageID, pdutlv.CString(id))
+	}
+	// Consistent with the stat and err of the text
+	if template.Has(dlr.TLVMessageState) {
+		tlv.Set(pdutlv.TagMessageStateOption, uint8(outcome.State))
+	}
+	if code := outcome.NetworkErrorCode(); code != nil && template.Has(dlr.TLVNetworkErrorCode) {
+		tlv.Set(pdutlv.TagNetworkErrorCode, code) // Network type and error code
+	}
 
-	return dlr
+	return d
 }
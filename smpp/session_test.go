@@ -0,0 +1,183 @@
+package smpp_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
+	"github.com/mdouchement/smsc3/client"
+	"github.com/mdouchement/smsc3/dlr"
+	"github.com/mdouchement/smsc3/handset"
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/mdouchement/smsc3/smsc"
+	"github.com/mdouchement/smsc3/smsctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession_MessageID(t *testing.T) {
+	tests := []struct {
+		mode     string
+		distinct bool // One message_id and one DLR per segment
+	}{
+		{mode: smpp.MessageIDPerMessage},
+		{mode: smpp.MessageIDPerSegment, distinct: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.mode, func(t *testing.T) {
+			t.Parallel()
+
+			server := smsctest.NewServer(&smsc.SMSC{
+				Accounts: []*smpp.Account{{SystemID: "esme", Password: "password", MessageID: tt.mode}},
+			})
+			defer server.Close()
+
+			receipts := make(chan client.Receipt, 4)
+			c, err := client.Dial(client.Config{
+				Addr:     server.Addr,
+				SystemID: "esme",
+				Password: server.Password,
+				OnReceipt: func(r client.Receipt) pdu.Status {
+					receipts <- r
+					return 0
+				},
+			})
+			require.NoError(t, err)
+			defer c.Close()
+
+			_, err = server.WaitSession("esme", time.Second)
+			require.NoError(t, err)
+
+			text, _, _ := pdutext.SelectCodec(strings.Repeat("long message ", 20))
+			ids, err := c.Send(&smpp.Message{
+				Src:      "GOPHER",
+				Dst:      "+33600000001",
+				Text:     text,
+				Register: pdufield.FinalDeliveryReceipt,
+			})
+			require.NoError(t, err)
+			require.Len(t, ids, 2)
+
+			expected := ids[:1]
+			if tt.distinct {
+				assert.NotEqual(t, ids[0], ids[1])
+				expected = ids
+			} else {
+				assert.Equal(t, ids[0], ids[1])
+			}
+
+			var received []string
+			for range expected {
+				select {
+				case r := <-receipts:
+					tlv := r.PDU.TLVFields()[pdutlv.TagReceiptedMessageID]
+					require.NotNil(t, tlv)
+					assert.Equal(t, r.ID, strings.TrimRight(tlv.String(), "\x00"))
+					received = append(received, r.ID)
+				case <-time.After(3 * time.Second):
+					t.Fatal("DLR not received")
+				}
+			}
+
+			select {
+			case r := <-receipts:
+				t.Fatalf("unexpected DLR %s", r.ID)
+			case <-time.After(500 * time.Millisecond):
+			}
+
+			sort.Strings(received)
+			expected = append([]string(nil), expected...)
+			sort.Strings(expected)
+			assert.Equal(t, expected, received)
+		})
+	}
+}
+
+func TestSession_PackedMultipart(t *testing.T) {
+	account := &smpp.Account{SystemID: "esme", Password: "password", GSM7: smpp.GSM7Packed}
+	server := smsctest.NewServer(&smsc.SMSC{Accounts: []*smpp.Account{account}})
+	defer server.Close()
+
+	c, err := client.Dial(client.Config{
+		Addr:     server.Addr,
+		SystemID: "esme",
+		Password: server.Password,
+		Account:  account,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = server.WaitSession("esme", time.Second)
+	require.NoError(t, err)
+
+	// 153 + 8 septets: the last segment has 1 fill bit and 7 spare bits padded with a CR.
+	text := strings.Repeat("a", 153) + "12345678"
+	codec, _, _ := pdutext.SelectCodec(text)
+	ids, err := c.Send(&smpp.Message{Src: "GOPHER", Dst: "+33600000001", Text: codec})
+	require.NoError(t, err)
+	require.Len(t, ids, 2)
+
+	r, err := http.Get(server.URL + "/inbox?msisdn=%2B33600000001")
+	require.NoError(t, err)
+	defer r.Body.Close()
+
+	var inbox struct {
+		Inbox handset.Mailbox `json:"inbox"`
+	}
+	require.NoError(t, json.NewDecoder(r.Body).Decode(&inbox))
+	require.Len(t, inbox.Inbox.Messages, 1)
+	assert.Equal(t, text, inbox.Inbox.Messages[0].Text)
+}
+
+func TestSession_ReceiptText(t *testing.T) {
+	template := dlr.Presets["smpp34"]
+	account := &smpp.Account{SystemID: "esme", Password: "password", DLR: &template}
+	server := smsctest.NewServer(&smsc.SMSC{Accounts: []*smpp.Account{account}})
+	defer server.Close()
+
+	receipts := make(chan client.Receipt, 1)
+	c, err := client.Dial(client.Config{
+		Addr:     server.Addr,
+		SystemID: "esme",
+		Password: server.Password,
+		OnReceipt: func(r client.Receipt) pdu.Status {
+			receipts <- r
+			return 0
+		},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = server.WaitSession("esme", time.Second)
+	require.NoError(t, err)
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{text: "First words " + strings.Repeat("long message ", 20), expected: "First words long mes"}, // Multipart
+		{text: "Привет hello", expected: "?????? hello"},                                               // UCS2
+	}
+	for _, tt := range tests {
+		codec, _, _ := pdutext.SelectCodec(tt.text)
+		_, err := c.Send(&smpp.Message{Src: "GOPHER", Dst: "+33600000001", Text: codec, Register: pdufield.FinalDeliveryReceipt})
+		require.NoError(t, err)
+
+		select {
+		case r := <-receipts:
+			assert.Equal(t, tt.expected, r.Text)
+			assert.Equal(t, []byte{0x00}, r.PDU.Fields()[pdufield.DataCoding].Bytes()) // Default alphabet
+		case <-time.After(3 * time.Second):
+			t.Fatal("DLR not received")
+		}
+	}
+}
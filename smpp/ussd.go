@@ -0,0 +1,310 @@
+package smpp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mdouchement/basex"
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
+	"github.com/mdouchement/smsc3/address"
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/pkg/errors"
+)
+
+// USSD service operations of the ussd_service_op TLV (SMPP 3.4 §5.3.2.44).
+const (
+	USSDPSSDIndication uint8 = 0x00
+	USSDPSSRIndication uint8 = 0x01
+	USSDUSSRRequest    uint8 = 0x02
+	USSDUSSNRequest    uint8 = 0x03
+	USSDPSSDResponse   uint8 = 0x10
+	USSDPSSRResponse   uint8 = 0x11
+	USSDUSSRConfirm    uint8 = 0x12
+	USSDUSSNConfirm    uint8 = 0x13
+)
+
+// USSD dialog states.
+const (
+	// DialogWaitingESME is the state of a dialog waiting for the ESME (USSR, USSN or PSSR response).
+	DialogWaitingESME DialogState = "waiting_esme"
+	// DialogWaitingUser is the state of a dialog waiting for the user reply (USSR confirm).
+	DialogWaitingUser DialogState = "waiting_user"
+	// DialogReleased is the state of a dialog ended by the ESME.
+	DialogReleased DialogState = "released"
+	// DialogAborted is the state of a dialog ended by the user.
+	DialogAborted DialogState = "aborted"
+)
+
+type (
+	// A DialogState is the state of a USSD dialog.
+	DialogState string
+
+	// A Dialog is a USSD dialog between a simulated user and an ESME.
+	// The messages are correlated with the its_session_info TLV, or with the MSISDN when the ESME does not echo it.
+	Dialog struct {
+		ID          string          `json:"id"`
+		Number      uint8           `json:"session_number"`
+		MSISDN      string          `json:"msisdn"`
+		ServiceCode string          `json:"service_code"`
+		State       DialogState     `json:"state"`
+		Messages    []DialogMessage `json:"messages"`
+		Updated     time.Time       `json:"updated_at"`
+		sequence    uint8
+	}
+
+	// A DialogMessage is a message of a USSD dialog.
+	DialogMessage struct {
+		Direction string    `json:"direction"` // mo (user to ESME) or mt (ESME to user)
+		Operation uint8     `json:"ussd_service_op"`
+		Text      string    `json:"text"`
+		Time      time.Time `json:"time"`
+	}
+
+	// Dialogs holds the USSD dialogs of a session.
+	Dialogs struct {
+		mu      sync.Mutex
+		timeout time.Duration
+		number  uint8
+		dialogs map[string]*Dialog
+	}
+)
+
+// NewDialogs returns a new Dialogs.
+// The ended and inactive dialogs are forgotten after the given timeout.
+func NewDialogs(timeout time.Duration) *Dialogs {
+	return &Dialogs{
+		timeout: timeout,
+		dialogs: map[string]*Dialog{},
+	}
+}
+
+// Open opens a new dialog for the given user and service code.
+func (d *Dialogs) Open(msisdn, code string) *Dialog {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.cleanup()
+
+	d.number++
+	dialog := &Dialog{
+		ID:          basex.GenerateID(),
+		Number:      d.number,
+		MSISDN:      msisdn,
+		ServiceCode: code,
+		State:       DialogWaitingESME,
+		Updated:     time.Now(),
+	}
+	d.dialogs[dialog.ID] = dialog
+
+	return dialog
+}
+
+// Get returns a copy of the dialog of the given ID.
+func (d *Dialogs) Get(id string) (Dialog, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dialog, ok := d.dialogs[id]
+	if !ok {
+		return Dialog{}, false
+	}
+
+	v := *dialog
+	v.Messages = append([]DialogMessage(nil), dialog.Messages...)
+	return v, true
+}
+
+// Update calls fn with the dialog of the given ID.
+func (d *Dialogs) Update(id string, fn func(*Dialog) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dialog, ok := d.dialogs[id]
+	if !ok {
+		return errors.New("dialog not found")
+	}
+	dialog.Updated = time.Now()
+	return fn(dialog)
+}
+
+// Find returns the ID of the open dialog of the given session number (its_session_info) or MSISDN.
+func (d *Dialogs) Find(number uint8, numbered bool, msisdn string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var found *Dialog
+	for _, dialog := range d.dialogs {
+		if dialog.Ended() {
+			continue
+		}
+
+		switch {
+		case numbered && dialog.Number == number:
+			return dialog.ID, true
+		case !numbered && dialog.MSISDN == msisdn && (found == nil || dialog.Updated.After(found.Updated)):
+			found = dialog
+		}
+	}
+
+	if found == nil {
+		return "", false
+	}
+	return found.ID, true
+}
+
+func (d *Dialogs) cleanup() {
+	for id, dialog := range d.dialogs {
+		if time.Since(dialog.Updated) > d.timeout {
+			delete(d.dialogs, id)
+		}
+	}
+}
+
+// Ended returns true if the dialog is released or aborted.
+func (d *Dialog) Ended() bool {
+	return d.State == DialogReleased || d.State == DialogAborted
+}
+
+// message records the message sent by the user and returns it.
+func (d *Dialog) message(op uint8, text string, end bool) *Message {
+	info := []byte{d.Number, d.sequence << 1} // its_session_info
+	if end {
+		info[1] |= 0x01
+	}
+	d.sequence++
+
+	d.Messages = append(d.Messages, DialogMessage{Direction: "mo", Operation: op, Text: text, Time: time.Now()})
+	d.State = DialogWaitingESME
+	if end {
+		d.State = DialogAborted
+	}
+
+	c, _, _ := pdutext.SelectCodec(text)
+	return &Message{
+		Src:         d.MSISDN,
+		Dst:         d.ServiceCode,
+		Text:        c,
+		ServiceType: "USSD",
+		TLVFields: pdutlv.Fields{
+			pdutlv.TagUssdServiceOp:  op,
+			pdutlv.TagItsSessionInfo: info,
+		},
+	}
+}
+
+// OpenDialog opens a USSD dialog toward the ESME: the user dials the given service code (PSSR indication).
+func (s *Session) OpenDialog(msisdn, code string) (Dialog, error) {
+	dialog := s.dialogs.Open(address.Parse(msisdn).String(), code) // As formatted in the deliver_sm
+
+	err := s.sendUSSD(dialog.ID, func(d *Dialog) (*Message, error) {
+		return d.message(USSDPSSRIndication, code, false), nil
+	})
+	v, _ := s.dialogs.Get(dialog.ID)
+	return v, err
+}
+
+// ReplyDialog sends the user reply to the last USSR request of the ESME (USSR confirm).
+func (s *Session) ReplyDialog(id, text string) (Dialog, error) {
+	err := s.sendUSSD(id, func(d *Dialog) (*Message, error) {
+		if d.State != DialogWaitingUser {
+			return nil, errors.Errorf("dialog is %s", d.State)
+		}
+		return d.message(USSDUSSRConfirm, text, false), nil
+	})
+	v, _ := s.dialogs.Get(id)
+	return v, err
+}
+
+// AbortDialog ends the dialog on the user side.
+func (s *Session) AbortDialog(id string) (Dialog, error) {
+	err := s.sendUSSD(id, func(d *Dialog) (*Message, error) {
+		if d.Ended() {
+			return nil, errors.Errorf("dialog is %s", d.State)
+		}
+		return d.message(USSDUSSRConfirm, "", true), nil
+	})
+	v, _ := s.dialogs.Get(id)
+	return v, err
+}
+
+// Dialog returns the USSD dialog of the given ID.
+func (s *Session) Dialog(id string) (Dialog, bool) {
+	return s.dialogs.Get(id)
+}
+
+// sendUSSD sends the message built by fn. The dialog is not locked while the deliver_sm_resp is awaited.
+func (s *Session) sendUSSD(id string, fn func(*Dialog) (*Message, error)) error {
+	var m *Message
+	err := s.dialogs.Update(id, func(d *Dialog) (err error) {
+		m, err = fn(d)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.Send(m, pdu.NewDeliverSM())
+}
+
+// handleUSSD tracks the USSD message sent by the ESME in its dialog.
+func (s *Session) handleUSSD(p pdu.Body) error {
+	tlv := p.TLVFields()
+	op := tlv[pdutlv.TagUssdServiceOp].Bytes()[0]
+
+	var number uint8
+	var numbered, end bool
+	if v := tlv[pdutlv.TagItsSessionInfo]; v != nil && len(v.Bytes()) == 2 {
+		number, numbered = v.Bytes()[0], true
+		end = v.Bytes()[1]&0x01 != 0
+	}
+
+	msisdn := p.Fields()[pdufield.DestinationAddr].String()
+	id, ok := s.dialogs.Find(number, numbered, msisdn)
+	if !ok {
+		return errors.Errorf("no USSD dialog found for %s", msisdn)
+	}
+
+	text, err := Text(p, s.c.Alphabet)
+	if err != nil {
+		return err
+	}
+
+	var confirm bool
+	err = s.dialogs.Update(id, func(d *Dialog) error {
+		d.Messages = append(d.Messages, DialogMessage{Direction: "mt", Operation: op, Text: text, Time: time.Now()})
+
+		switch op {
+		case USSDUSSRRequest:
+			d.State = DialogWaitingUser
+		case USSDUSSNRequest:
+			confirm = !end
+		case USSDPSSRResponse, USSDPSSDResponse:
+			d.State = DialogReleased
+		}
+		if end {
+			d.State = DialogReleased
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.log.Infof("USSD dialog %s: %s", id, text)
+
+	if confirm {
+		// The handset acknowledges the notification.
+		go func() {
+			err := s.sendUSSD(id, func(d *Dialog) (*Message, error) {
+				return d.message(USSDUSSNConfirm, "", false), nil
+			})
+			if err != nil {
+				s.log.WithError(err).Error("Could not confirm USSN")
+			}
+		}()
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package smpp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialogs(t *testing.T) {
+	d := smpp.NewDialogs(time.Minute)
+
+	first := d.Open("33600000001", "*123#")
+	second := d.Open("33600000001", "*144#")
+	assert.NotEqual(t, first.Number, second.Number)
+
+	id, ok := d.Find(first.Number, true, "")
+	assert.True(t, ok)
+	assert.Equal(t, first.ID, id)
+
+	id, ok = d.Find(0, false, "33600000001")
+	assert.True(t, ok)
+	assert.Equal(t, second.ID, id) // Latest updated dialog of the MSISDN
+
+	err := d.Update(second.ID, func(dialog *smpp.Dialog) error {
+		dialog.State = smpp.DialogReleased
+		return nil
+	})
+	assert.NoError(t, err)
+
+	id, ok = d.Find(0, false, "33600000001")
+	assert.True(t, ok)
+	assert.Equal(t, first.ID, id) // Ended dialogs are ignored
+
+	dialog, ok := d.Get(second.ID)
+	assert.True(t, ok)
+	assert.True(t, dialog.Ended())
+
+	assert.Error(t, d.Update("unknown", func(*smpp.Dialog) error { return nil }))
+}
@@ -4,23 +4,104 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/mdouchement/basex"
 	"github.com/mdouchement/smpp/smpp/pdu"
 	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
 	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
+	"github.com/mdouchement/smsc3/dlr"
+	"github.com/mdouchement/smsc3/handset"
 	"github.com/mdouchement/smsc3/pdutext"
 	"github.com/mdouchement/smsc3/smpp"
+	"github.com/mdouchement/smsc3/wap"
 	"github.com/pkg/errors"
 )
 
 type (
 	// An SMSParams is used to send an SMS through HTTP.
 	SMSParams struct {
-		Session string `json:"session"`
+		Session string `json:"session"` // Optional, routed according to the destination number by default
 		From    string `json:"from"`
 		To      string `json:"to"`
 		Message string `json:"message"`
+		Coding  string `json:"coding"`
+
+		// Application port addressing, 16-bit addresses are used when a port is over 255 or when wide_ports is set.
+		SourcePort      int  `json:"source_port"`
+		DestinationPort int  `json:"destination_port"`
+		WidePorts       bool `json:"wide_ports"`
+
+		WAPPush *WAPPushParams `json:"wap_push"`
+		Receipt *dlr.Receipt   `json:"receipt"` // Delivery receipt sent in place of the message
+
+		Class           string `json:"class"` // Message class: 0 (flash), 1, 2 (SIM) or 3
+		DestAddrSubunit uint8  `json:"dest_addr_subunit"`
+		ProtocolID      uint8  `json:"protocol_id"` // e.g. 64 (0x40) for a silent SMS, 65-71 (0x41-0x47) for the replace types
+	}
+
+	// A WAPPushParams is used to send a WAP Push (Service Indication or Service Loading) through HTTP.
+	WAPPushParams struct {
+		Type    string    `json:"type"` // si or sl
+		URL     string    `json:"url"`
+		Text    string    `json:"text"`
+		ID      string    `json:"id"`
+		Action  string    `json:"action"`
+		Created time.Time `json:"created"`
+		Expires time.Time `json:"expires"`
+	}
+
+	// A MWIParams is used to send a message waiting indication (e.g. voicemail waiting) through HTTP.
+	MWIParams struct {
+		Session string   `json:"session"` // Optional, routed according to the destination number by default
+		From    string   `json:"from"`
+		To      string   `json:"to"`
+		Type    string   `json:"type"`    // voicemail (default), fax, email or other
+		Count   int      `json:"count"`   // Number of waiting messages, 0 clears the indication
+		Store   bool     `json:"store"`   // Store the message, discarded otherwise
+		Methods []string `json:"methods"` // udh (default), data_coding and/or tlv
+		Message string   `json:"message"`
+	}
+
+	// A DLRParams is used to send a DLR held by an account in manual DLR mode through HTTP.
+	DLRParams struct {
+		Session  string    `json:"session"`   // Optional, the session holding the message by default
+		ID       string    `json:"id"`        // message_id given in the submit_sm_resp
+		Stat     string    `json:"stat"`      // Short or long name of the state, DELIVRD by default
+		Err      int       `json:"err"`       // Error code of a failure
+		Network  string    `json:"network"`   // gsm (default), ansi136 or is95
+		DoneDate time.Time `json:"done_date"` // Now by default
+	}
+
+	// A USSDParams is used to open, reply to or abort a USSD dialog through HTTP.
+	USSDParams struct {
+		Session string `json:"session"`
+		Dialog  string `json:"dialog"`  // Dialog ID, to reply or abort
+		From    string `json:"from"`    // MSISDN of the user, to open
+		To      string `json:"to"`      // Service code (e.g. *123#), to open
+		Message string `json:"message"` // User reply
+	}
+
+	// A USSDRender is used to render a USSD dialog through HTTP.
+	USSDRender struct {
+		Status  int          `json:"status"`
+		Message string       `json:"message"`
+		Dialog  *smpp.Dialog `json:"dialog,omitempty"`
+	}
+
+	// An InboxRender is used to render the inbox of a simulated handset through HTTP.
+	InboxRender struct {
+		Status  int              `json:"status"`
+		Message string           `json:"message"`
+		Inbox   *handset.Mailbox `json:"inbox,omitempty"`
+	}
+
+	// A DLRRender is used to render the deliver_sm_resp of a DLR sent through HTTP.
+	DLRRender struct {
+		Status        int    `json:"status"`
+		Message       string `json:"message"`
+		CommandStatus uint32 `json:"command_status"` // command_status of the deliver_sm_resp
 	}
 
 	// An SMSRender is used to render the result of a sent SMS through HTTP.
@@ -31,7 +112,15 @@ type (
 )
 
 func (smsc *SMSC) http() error {
-	http.HandleFunc("/deliver", func(w http.ResponseWriter, r *http.Request) {
+	smsc.lhttp.Infof("Listening HTTP on %s", smsc.HTTPaddr)
+	return http.ListenAndServe(smsc.HTTPaddr, smsc.HTTPHandler())
+}
+
+// HTTPHandler returns the handler of the HTTP API.
+func (smsc *SMSC) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/deliver", func(w http.ResponseWriter, r *http.Request) {
 		smsc.lhttp.Info("Got a SMS to deliver")
 
 		var params SMSParams
@@ -40,55 +129,434 @@ func (smsc *SMSC) http() error {
 			return
 		}
 
-		{
-			if params.Session == "" {
-				smsc.render(w, http.StatusBadRequest, "missing session name")
-				return
-			}
-			if params.From == "" {
-				smsc.render(w, http.StatusBadRequest, "missing from")
-				return
-			}
-			if params.To == "" {
-				smsc.render(w, http.StatusBadRequest, "missing to")
-				return
+		smsc.send(w, params.Session, params.From, params.To, func(m *smpp.Message, account *smpp.Account) (string, error) {
+			if params.Message == "" && params.WAPPush == nil && params.Receipt == nil {
+				return "", errors.New("missing message")
 			}
-			if params.Message == "" {
-				smsc.render(w, http.StatusBadRequest, "missing message")
-				return
+
+			id := basex.GenerateID()
+			m.Register = pdufield.FinalDeliveryReceipt
+			m.TLVFields[pdutlv.TagReceiptedMessageID] = pdutlv.CString(id)
+			return id, smsc.message(m, params, account)
+		})
+	})
+
+	mux.HandleFunc("/mwi", func(w http.ResponseWriter, r *http.Request) {
+		smsc.lhttp.Info("Got a message waiting indication to deliver")
+
+		var params MWIParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			smsc.render(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		smsc.send(w, params.Session, params.From, params.To, func(m *smpp.Message, account *smpp.Account) (string, error) {
+			if params.Count < 0 || params.Count > 0xFF {
+				return "", errors.New("invalid count")
 			}
+			return "", smsc.waiting(m, params, account)
+		})
+	})
+
+	mux.HandleFunc("/dlr", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			smsc.renderDLR(w, http.StatusMethodNotAllowed, "method not allowed", 0)
+			return
 		}
 
-		session := smsc.Session(params.Session)
+		var params DLRParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			smsc.renderDLR(w, http.StatusInternalServerError, err.Error(), 0)
+			return
+		}
+		if params.ID == "" {
+			smsc.renderDLR(w, http.StatusBadRequest, "missing id", 0)
+			return
+		}
+
+		// Same stat, err and network as the DLR outcome rules
+		rule := dlr.Rule{Stat: params.Stat, Err: params.Err, Network: params.Network}
+		if err := rule.Compile(); err != nil {
+			smsc.renderDLR(w, http.StatusBadRequest, err.Error(), 0)
+			return
+		}
+
+		session, err := smsc.Holder(params.Session, params.ID)
+		if errors.Is(err, smpp.ErrNotHeld) {
+			smsc.renderDLR(w, http.StatusNotFound, err.Error(), 0)
+			return
+		}
+		if err != nil {
+			smsc.renderDLR(w, http.StatusBadRequest, err.Error(), 0)
+			return
+		}
+
+		status, err := session.SendDLR(params.ID, rule.Outcome(), params.DoneDate)
+		if errors.Is(err, smpp.ErrNotHeld) {
+			smsc.renderDLR(w, http.StatusNotFound, err.Error(), 0)
+			return
+		}
+		if errors.Is(err, smpp.ErrNotRequested) {
+			smsc.renderDLR(w, http.StatusConflict, err.Error(), 0)
+			return
+		}
+		if err != nil {
+			smsc.renderDLR(w, http.StatusInternalServerError, err.Error(), 0)
+			return
+		}
+
+		message := "OK"
+		if status != 0 {
+			message = status.Error()
+		}
+		smsc.renderDLR(w, http.StatusOK, message, status)
+	})
+
+	mux.HandleFunc("/ussd", smsc.ussd(func(session *smpp.Session, params USSDParams) (smpp.Dialog, error) {
+		if params.From == "" {
+			return smpp.Dialog{}, errors.New("missing from")
+		}
+		if params.To == "" {
+			return smpp.Dialog{}, errors.New("missing to")
+		}
+		return session.OpenDialog(params.From, params.To)
+	}))
+
+	mux.HandleFunc("/ussd/reply", smsc.ussd(func(session *smpp.Session, params USSDParams) (smpp.Dialog, error) {
+		return session.ReplyDialog(params.Dialog, params.Message)
+	}))
+
+	mux.HandleFunc("/ussd/abort", smsc.ussd(func(session *smpp.Session, params USSDParams) (smpp.Dialog, error) {
+		return session.AbortDialog(params.Dialog)
+	}))
+
+	mux.HandleFunc("/ussd/dialog", func(w http.ResponseWriter, r *http.Request) {
+		session := smsc.Session(r.URL.Query().Get("session"))
 		if session == nil {
-			smsc.render(w, http.StatusBadRequest, "session not found")
+			smsc.renderUSSD(w, http.StatusBadRequest, "session not found", nil)
+			return
+		}
+
+		dialog, ok := session.Dialog(r.URL.Query().Get("dialog"))
+		if !ok {
+			smsc.renderUSSD(w, http.StatusNotFound, "dialog not found", nil)
 			return
 		}
 
-		id := basex.GenerateID()
+		smsc.renderUSSD(w, http.StatusOK, "OK", &dialog)
+	})
 
-		m := &smpp.Message{
-			Src:      params.From,
-			Dst:      params.To,
-			Register: pdufield.FinalDeliveryReceipt,
-			TLVFields: pdutlv.Fields{
-				pdutlv.TagReceiptedMessageID: pdutlv.CString(id),
-			},
+	mux.HandleFunc("/inbox", func(w http.ResponseWriter, r *http.Request) {
+		msisdn := r.URL.Query().Get("msisdn")
+		if msisdn == "" && r.Method == http.MethodDelete {
+			smsc.inbox.ClearAll()
+			smsc.renderInbox(w, http.StatusOK, "OK", nil)
+			return
+		}
+		if msisdn == "" {
+			smsc.renderInbox(w, http.StatusBadRequest, "missing msisdn", nil)
+			return
 		}
-		m.Text, m.Size, m.Segments = pdutext.SelectCodec(params.Message)
 
-		p := pdu.NewDeliverSM()
-		smsc.lhttp.Infof("NewDeliverSM: %d", p.Header().Seq)
-		if err := session.Send(m, p); err != nil {
-			smsc.render(w, http.StatusInternalServerError, err.Error())
+		switch r.Method {
+		case http.MethodGet:
+			mailbox := smsc.inbox.Mailbox(msisdn)
+			smsc.renderInbox(w, http.StatusOK, "OK", &mailbox)
+		case http.MethodDelete:
+			smsc.inbox.Clear(msisdn)
+			smsc.renderInbox(w, http.StatusOK, "OK", nil)
+		default:
+			smsc.renderInbox(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		}
+	})
+
+	mux.HandleFunc("/script/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			smsc.render(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if smsc.script == nil {
+			smsc.render(w, http.StatusNotFound, "no script")
 			return
 		}
 
-		smsc.render(w, http.StatusOK, fmt.Sprintf("OK %s (%d)", id, p.Header().Seq))
+		if err := smsc.script.Reload(); err != nil {
+			smsc.render(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		smsc.render(w, http.StatusOK, "OK")
 	})
 
-	smsc.lhttp.Infof("Listening HTTP on %s", smsc.HTTPaddr)
-	return http.ListenAndServe(smsc.HTTPaddr, nil)
+	return mux
+}
+
+// send delivers a message through HTTP (/deliver, /mwi) to the named session, or to the session owning the recipient,
+// and renders the result. The build function fills the message for the account of the session,
+// it returns the message_id reported in the response, if any.
+func (smsc *SMSC) send(w http.ResponseWriter, name, from, to string, build func(*smpp.Message, *smpp.Account) (string, error)) {
+	if from == "" {
+		smsc.render(w, http.StatusBadRequest, "missing from")
+		return
+	}
+	if to == "" {
+		smsc.render(w, http.StatusBadRequest, "missing to")
+		return
+	}
+
+	session, err := smsc.Recipient(name, to)
+	if err != nil {
+		smsc.render(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	m := &smpp.Message{
+		Src:       from,
+		Dst:       to,
+		TLVFields: pdutlv.Fields{},
+	}
+	id, err := build(m, session.Account())
+	if err != nil {
+		smsc.render(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p := pdu.NewDeliverSM()
+	smsc.lhttp.Infof("NewDeliverSM: %d", p.Header().Seq)
+	if err := session.Send(m, p); err != nil {
+		smsc.render(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if id != "" {
+		id += " "
+	}
+	smsc.render(w, http.StatusOK, fmt.Sprintf("OK %s(%d)", id, p.Header().Seq))
+}
+
+// message sets the text, the UDH and the class of the given message.
+func (smsc *SMSC) message(m *smpp.Message, params SMSParams, account *smpp.Account) (err error) {
+	m.Class, err = pdutext.ParseMessageClass(params.Class)
+	if err != nil {
+		return err
+	}
+	m.DestAddrSubunit = params.DestAddrSubunit
+	m.ProtocolID = params.ProtocolID
+
+	if params.Receipt != nil {
+		return smsc.receipt(m, *params.Receipt)
+	}
+
+	if params.WAPPush != nil {
+		push, err := params.WAPPush.Encode()
+		if err != nil {
+			return err
+		}
+
+		m.Text = pdutext.Binary(push)
+		m.UDH.Add(pdutext.ApplicationPort{Destination: wap.PortPush, Source: wap.PortWSP, Wide: true})
+		m.Size, m.Segments = pdutext.CountWithUDH(m.Text, m.UDH)
+		_, err = pdutext.ClassCoding(m.Text, m.Class)
+		return err
+	}
+
+	c, err := pdutext.ParseCodec(params.Coding, params.Message, account.Languages...)
+	if err != nil {
+		return err
+	}
+	m.Text = c
+
+	if params.DestinationPort != 0 || params.SourcePort != 0 {
+		if params.DestinationPort < 0 || params.DestinationPort > 0xFFFF || params.SourcePort < 0 || params.SourcePort > 0xFFFF {
+			return errors.New("invalid application port")
+		}
+
+		m.UDH.Add(pdutext.ApplicationPort{
+			Destination: uint16(params.DestinationPort),
+			Source:      uint16(params.SourcePort),
+			Wide:        params.WidePorts || params.DestinationPort > 0xFF || params.SourcePort > 0xFF,
+		})
+	}
+
+	m.Size, m.Segments = pdutext.CountWithUDH(m.Text, m.UDH)
+	_, err = pdutext.ClassCoding(m.Text, m.Class)
+	return err
+}
+
+// receipt sets the text of the given delivery receipt.
+// The dates default to now and the stat accepts the long names of the states (e.g. DELIVERED).
+func (smsc *SMSC) receipt(m *smpp.Message, r dlr.Receipt) error {
+	if r.ID == "" {
+		return errors.New("missing receipt id")
+	}
+	state, ok := dlr.ParseState(r.Stat)
+	if !ok {
+		return errors.Errorf("invalid receipt stat %q", r.Stat)
+	}
+	r.Stat = state.Stat()
+
+	if r.DoneDate.IsZero() {
+		r.DoneDate = time.Now()
+	}
+	if r.SubmitDate.IsZero() {
+		r.SubmitDate = r.DoneDate
+	}
+
+	c, _, _ := pdutext.SelectCodec(r.String())
+	m.Text = c
+	m.ESMClass = 0b100 // SMSC Delivery Receipt
+	if state.Intermediate() {
+		m.ESMClass = 0b100000 // Intermediate Delivery Notification
+	}
+	m.TLVFields[pdutlv.TagReceiptedMessageID] = pdutlv.CString(r.ID)
+
+	m.Size, m.Segments = pdutext.CountWithUDH(m.Text, m.UDH)
+	return nil
+}
+
+// waiting sets the text and the message waiting indication of the given message.
+func (smsc *SMSC) waiting(m *smpp.Message, params MWIParams, account *smpp.Account) error {
+	t, err := pdutext.ParseIndicationType(params.Type)
+	if err != nil {
+		return err
+	}
+
+	mw := pdutext.MessageWaiting{
+		Type:   t,
+		Active: params.Count > 0,
+		Store:  params.Store,
+		Count:  params.Count,
+	}
+
+	message := params.Message
+	if message == "" {
+		name := strings.ToLower(params.Type)
+		if name == "" {
+			name = "voicemail"
+		}
+		message = fmt.Sprintf("%d %s message(s) waiting", params.Count, name)
+	}
+	m.Text, _, _ = pdutext.SelectCodec(message, account.Languages...)
+
+	methods := params.Methods
+	if len(methods) == 0 {
+		methods = []string{"udh"}
+	}
+	for _, method := range methods {
+		switch strings.ToLower(method) {
+		case "udh":
+			m.UDH.Add(mw.IE())
+		case "data_coding", "dcs":
+			m.Waiting = &mw
+			if _, err := mw.Coding(m.Text); err != nil {
+				return err
+			}
+		case "tlv":
+			m.TLVFields[pdutlv.TagMsMsgWaitFacilities] = mw.Facilities()
+		default:
+			return errors.Errorf("unsupported message waiting indication method: %s", method)
+		}
+	}
+
+	m.Size, m.Segments = pdutext.CountWithUDH(m.Text, m.UDH)
+	return nil
+}
+
+// Encode returns the WSP push PDU of the WAP Push.
+func (params WAPPushParams) Encode() ([]byte, error) {
+	switch strings.ToLower(params.Type) {
+	case "", "si":
+		return wap.ServiceIndication{
+			URL:     params.URL,
+			Text:    params.Text,
+			ID:      params.ID,
+			Action:  params.Action,
+			Created: params.Created,
+			Expires: params.Expires,
+		}.Encode()
+	case "sl":
+		return wap.ServiceLoading{
+			URL:    params.URL,
+			Action: params.Action,
+		}.Encode()
+	}
+
+	return nil, errors.Errorf("unsupported WAP Push type: %s", params.Type)
+}
+
+// ussd returns the handler of a USSD dialog action.
+// The response of the ESME is asynchronous, see /ussd/dialog.
+func (smsc *SMSC) ussd(action func(*smpp.Session, USSDParams) (smpp.Dialog, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		smsc.lhttp.Infof("Got a USSD action %s", r.URL.Path)
+
+		var params USSDParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			smsc.renderUSSD(w, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+
+		session := smsc.Session(params.Session)
+		if session == nil {
+			smsc.renderUSSD(w, http.StatusBadRequest, "session not found", nil)
+			return
+		}
+
+		dialog, err := action(session, params)
+		if err != nil {
+			smsc.renderUSSD(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		smsc.renderUSSD(w, http.StatusOK, "OK", &dialog)
+	}
+}
+
+func (smsc *SMSC) renderUSSD(w http.ResponseWriter, code int, message string, dialog *smpp.Dialog) {
+	smsc.lhttp.Infof("[%d] %s", code, message)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(&USSDRender{
+		Status:  code,
+		Message: message,
+		Dialog:  dialog,
+	})
+	if err != nil {
+		smsc.lhttp.Error(errors.Wrap(err, "http: render"))
+	}
+}
+
+func (smsc *SMSC) renderInbox(w http.ResponseWriter, code int, message string, mailbox *handset.Mailbox) {
+	smsc.lhttp.Infof("[%d] %s", code, message)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(&InboxRender{
+		Status:  code,
+		Message: message,
+		Inbox:   mailbox,
+	})
+	if err != nil {
+		smsc.lhttp.Error(errors.Wrap(err, "http: render"))
+	}
+}
+
+func (smsc *SMSC) renderDLR(w http.ResponseWriter, code int, message string, status pdu.Status) {
+	smsc.lhttp.Infof("[%d] %s", code, message)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(&DLRRender{
+		Status:        code,
+		Message:       message,
+		CommandStatus: uint32(status),
+	})
+	if err != nil {
+		smsc.lhttp.Error(errors.Wrap(err, "http: render"))
+	}
 }
 
 func (smsc *SMSC) render(w http.ResponseWriter, code int, message string) {
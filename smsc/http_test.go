@@ -0,0 +1,302 @@
+package smsc_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smsc3/client"
+	"github.com/mdouchement/smsc3/dlr"
+	"github.com/mdouchement/smsc3/handset"
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/mdouchement/smsc3/smsc"
+	"github.com/mdouchement/smsc3/smsctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dial(t *testing.T, server *smsctest.Server) *client.Client {
+	c, err := client.Dial(client.Config{
+		Addr:     server.Addr,
+		SystemID: "esme",
+		Password: server.Password,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	_, err = server.WaitSession("esme", time.Second)
+	require.NoError(t, err)
+	return c
+}
+
+func TestDeliver_Receipt(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+
+	receipts := make(chan client.Receipt, 1)
+	c, err := client.Dial(client.Config{
+		Addr:     server.Addr,
+		SystemID: "esme",
+		Password: server.Password,
+		OnReceipt: func(r client.Receipt) pdu.Status {
+			receipts <- r
+			return 0
+		},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = server.WaitSession("esme", time.Second)
+	require.NoError(t, err)
+
+	done := time.Date(2024, 10, 19, 12, 1, 0, 0, time.Local)
+	body, _ := json.Marshal(smsc.SMSParams{
+		Session: "esme",
+		From:    "+33600000001",
+		To:      "GOPHER",
+		Receipt: &dlr.Receipt{ID: "42", Sub: 1, Stat: "undeliverable", Err: 69, DoneDate: done},
+	})
+	r, err := http.Post(server.URL+"/deliver", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer r.Body.Close()
+	assert.Equal(t, http.StatusOK, r.StatusCode)
+
+	select {
+	case receipt := <-receipts:
+		assert.Equal(t, "42", receipt.ID)
+		assert.Equal(t, "UNDELIV", receipt.Stat)
+		assert.Equal(t, 69, receipt.Err)
+		assert.Equal(t, done, receipt.DoneDate)
+		assert.Equal(t, done, receipt.SubmitDate)
+		assert.True(t, receipt.Final)
+	case <-time.After(3 * time.Second):
+		t.Fatal("DLR not received")
+	}
+
+	body, _ = json.Marshal(smsc.SMSParams{
+		Session: "esme",
+		From:    "+33600000001",
+		To:      "GOPHER",
+		Receipt: &dlr.Receipt{ID: "42", Stat: "FAILED"},
+	})
+	r, err = http.Post(server.URL+"/deliver", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer r.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, r.StatusCode)
+}
+
+func TestDeliver_Coding(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+
+	dial(t, server)
+
+	body, _ := json.Marshal(smsc.SMSParams{
+		Session: "esme",
+		From:    "+33600000001",
+		To:      "GOPHER",
+		Message: "Prix : 10 €",
+		Coding:  "latin1",
+	})
+	r, err := http.Post(server.URL+"/deliver", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer r.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, r.StatusCode)
+}
+
+func TestMWI(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+
+	dial(t, server)
+
+	for _, tt := range []struct {
+		params smsc.MWIParams
+		status int
+	}{
+		{params: smsc.MWIParams{Session: "esme", From: "+33600000001", To: "GOPHER", Count: 2}, status: http.StatusOK},
+		{params: smsc.MWIParams{Session: "esme", From: "+33600000001", To: "GOPHER", Count: 256}, status: http.StatusBadRequest},
+		{params: smsc.MWIParams{Session: "esme", To: "GOPHER"}, status: http.StatusBadRequest},
+	} {
+		body, _ := json.Marshal(tt.params)
+		r, err := http.Post(server.URL+"/mwi", "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		r.Body.Close()
+		assert.Equal(t, tt.status, r.StatusCode)
+	}
+}
+
+func TestInbox_Class(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+	c := dial(t, server)
+
+	for _, class := range []pdutext.MessageClass{pdutext.Class0, pdutext.ClassNone} {
+		_, err := c.Send(&smpp.Message{Src: "GOPHER", Dst: "+33600000001", Text: pdutext.GSM7("hello"), Class: class})
+		require.NoError(t, err)
+	}
+
+	r, err := http.Get(server.URL + "/inbox?msisdn=%2B33600000001")
+	require.NoError(t, err)
+	defer r.Body.Close()
+
+	var inbox struct {
+		Inbox handset.Mailbox `json:"inbox"`
+	}
+	require.NoError(t, json.NewDecoder(r.Body).Decode(&inbox))
+	require.Len(t, inbox.Inbox.Messages, 2)
+	assert.Equal(t, "0 (flash)", inbox.Inbox.Messages[0].Class)
+	assert.Empty(t, inbox.Inbox.Messages[1].Class)
+}
+
+func TestDLR_Manual(t *testing.T) {
+	server := smsctest.NewServer(&smsc.SMSC{
+		Accounts: []*smpp.Account{{
+			SystemID: "esme",
+			Password: "password",
+			DLRMode:  smpp.DLRManual,
+		}},
+	})
+	defer server.Close()
+
+	receipts := make(chan client.Receipt, 1)
+	c, err := client.Dial(client.Config{
+		Addr:     server.Addr,
+		SystemID: "esme",
+		Password: server.Password,
+		OnReceipt: func(r client.Receipt) pdu.Status {
+			receipts <- r
+			if r.Final {
+				return pdu.Status(0x45)
+			}
+			return 0
+		},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = server.WaitSession("esme", time.Second)
+	require.NoError(t, err)
+
+	text, _, _ := pdutext.SelectCodec("hello")
+	ids, err := c.Send(&smpp.Message{
+		Src:      "GOPHER",
+		Dst:      "+33600000001",
+		Text:     text,
+		Register: pdufield.FinalDeliveryReceipt,
+	})
+	require.NoError(t, err)
+	id := ids[0]
+
+	select {
+	case <-receipts:
+		t.Fatal("DLR not held")
+	case <-time.After(1500 * time.Millisecond):
+	}
+
+	code, render := postDLR(t, server.URL, smsc.DLRParams{ID: id, Stat: "ENROUTE"})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, uint32(0), render.CommandStatus)
+	receipt := <-receipts
+	assert.Equal(t, id, receipt.ID)
+	assert.Equal(t, "ENROUTE", receipt.Stat)
+	assert.False(t, receipt.Final)
+
+	done := time.Date(2024, 10, 19, 12, 1, 0, 0, time.Local)
+	code, render = postDLR(t, server.URL, smsc.DLRParams{Session: "esme", ID: id, Stat: "UNDELIV", Err: 12, DoneDate: done})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, uint32(0x45), render.CommandStatus)
+	receipt = <-receipts
+	assert.Equal(t, "UNDELIV", receipt.Stat)
+	assert.Equal(t, 12, receipt.Err)
+	assert.Equal(t, done, receipt.DoneDate)
+	assert.True(t, receipt.Final)
+
+	// Released by the final DLR
+	code, _ = postDLR(t, server.URL, smsc.DLRParams{ID: id})
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = postDLR(t, server.URL, smsc.DLRParams{ID: id, Stat: "FAILED"})
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestDLR_ManualRegisteredDelivery(t *testing.T) {
+	server := smsctest.NewServer(&smsc.SMSC{
+		Accounts: []*smpp.Account{{
+			SystemID: "esme",
+			Password: "password",
+			DLRMode:  smpp.DLRManual,
+		}},
+	})
+	defer server.Close()
+
+	receipts := make(chan client.Receipt, 1)
+	c, err := client.Dial(client.Config{
+		Addr:     server.Addr,
+		SystemID: "esme",
+		Password: server.Password,
+		OnReceipt: func(r client.Receipt) pdu.Status {
+			receipts <- r
+			return 0
+		},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = server.WaitSession("esme", time.Second)
+	require.NoError(t, err)
+
+	send := func(rd pdufield.DeliverySetting) string {
+		text, _, _ := pdutext.SelectCodec("hello")
+		ids, err := c.Send(&smpp.Message{Src: "GOPHER", Dst: "+33600000001", Text: text, Register: rd})
+		require.NoError(t, err)
+		return ids[0]
+	}
+
+	// No DLR requested, nothing held
+	code, _ := postDLR(t, server.URL, smsc.DLRParams{ID: send(pdufield.NoDeliveryReceipt)})
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// DLR requested on success only (2)
+	id := send(pdufield.DeliverySetting(0x02))
+	code, render := postDLR(t, server.URL, smsc.DLRParams{ID: id, Stat: "ENROUTE"})
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, smpp.ErrNotRequested.Error(), render.Message)
+	code, _ = postDLR(t, server.URL, smsc.DLRParams{ID: id, Stat: "UNDELIV", Err: 12})
+	assert.Equal(t, http.StatusConflict, code)
+	code, _ = postDLR(t, server.URL, smsc.DLRParams{ID: id}) // Released by the final failure
+	assert.Equal(t, http.StatusNotFound, code)
+
+	select {
+	case r := <-receipts:
+		t.Fatalf("unexpected DLR %s", r.Stat)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	id = send(pdufield.DeliverySetting(0x02))
+	code, _ = postDLR(t, server.URL, smsc.DLRParams{ID: id})
+	assert.Equal(t, http.StatusOK, code)
+	select {
+	case r := <-receipts:
+		assert.Equal(t, id, r.ID)
+		assert.Equal(t, "DELIVRD", r.Stat)
+	case <-time.After(3 * time.Second):
+		t.Fatal("DLR not received")
+	}
+}
+
+func postDLR(t *testing.T, url string, params smsc.DLRParams) (int, smsc.DLRRender) {
+	body, _ := json.Marshal(params)
+	r, err := http.Post(url+"/dlr", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer r.Body.Close()
+
+	var render smsc.DLRRender
+	require.NoError(t, json.NewDecoder(r.Body).Decode(&render))
+	return r.StatusCode, render
+}
@@ -0,0 +1,157 @@
+package smsc
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/pkg/errors"
+)
+
+// A Route delivers the messages sent to the numbers starting with Prefix and/or matching Pattern
+// to the ESME bound with SystemID. It is used for the messages submitted by the ESMEs and for /deliver.
+type Route struct {
+	Prefix   string `json:"prefix"`
+	Pattern  string `json:"pattern"` // Regular expression
+	SystemID string `json:"system_id"`
+
+	re *regexp.Regexp
+}
+
+// Compile compiles the pattern of the route.
+func (r *Route) Compile() (err error) {
+	if r.Pattern == "" {
+		return nil
+	}
+
+	r.re, err = regexp.Compile(r.Pattern)
+	return errors.Wrapf(err, "route %s", r.SystemID)
+}
+
+// Match returns true if the given number matches the route.
+func (r *Route) Match(dst string) bool {
+	if !strings.HasPrefix(strings.TrimPrefix(dst, "+"), r.prefix()) {
+		return false
+	}
+	return r.re == nil || r.re.MatchString(dst)
+}
+
+func (r *Route) prefix() string {
+	return strings.TrimPrefix(r.Prefix, "+")
+}
+
+// Route returns the route of the given destination number.
+// The route with the longest matching prefix wins, then the first declared one.
+func (smsc *SMSC) Route(dst string) (*Route, bool) {
+	var found *Route
+	for _, route := range smsc.Routes {
+		if !route.Match(dst) {
+			continue
+		}
+
+		if found == nil || len(route.prefix()) > len(found.prefix()) {
+			found = route
+		}
+	}
+
+	return found, found != nil
+}
+
+// Owner returns the system_id of the ESME owning the given number according to the routes.
+// It routes the messages submitted by the ESMEs.
+func (smsc *SMSC) Owner(dst string) (string, bool) {
+	if route, ok := smsc.Route(dst); ok {
+		return route.SystemID, true
+	}
+	return "", false
+}
+
+// ranger returns the system_id of the first bound receiver or transceiver session whose address_range matches the given number.
+func (smsc *SMSC) ranger(dst string) (string, bool) {
+	smsc.mu.Lock()
+	names := make([]string, 0, len(smsc.sessions))
+	for name := range smsc.sessions {
+		names = append(names, name)
+	}
+	smsc.mu.Unlock()
+	sort.Strings(names) // Deterministic when several address ranges match
+
+	for _, name := range names {
+		if session := smsc.Session(name); session != nil && !session.Transmitter() && session.InAddressRange(dst) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Recipient returns the session receiving the messages (MO) sent to the given destination number through the HTTP API:
+// the session of the given name, or when the name is empty the owner of the number according to the routes,
+// then to the address_range of the bound sessions. The number must match the address_range of the session, if any.
+func (smsc *SMSC) Recipient(name, dst string) (*smpp.Session, error) {
+	if name == "" {
+		var ok bool
+		if name, ok = smsc.Owner(dst); !ok {
+			if name, ok = smsc.ranger(dst); !ok {
+				return nil, errors.Errorf("no route to %s", dst)
+			}
+		}
+	}
+
+	session := smsc.Session(name)
+	if session == nil {
+		return nil, errors.Errorf("session %s not found", name)
+	}
+	if session.Transmitter() {
+		return nil, errors.Errorf("session %s is bound as transmitter", name)
+	}
+
+	if session.HasAddressRange() && !session.InAddressRange(dst) {
+		return nil, errors.Errorf("%s does not match the address_range of %s", dst, name)
+	}
+	return session, nil
+}
+
+// Holder returns the session holding the DLR of the given message_id, the named session when given.
+func (smsc *SMSC) Holder(name, id string) (*smpp.Session, error) {
+	if name != "" {
+		session := smsc.Session(name)
+		if session == nil {
+			return nil, errors.Errorf("session %s not found", name)
+		}
+		return session, nil
+	}
+
+	smsc.mu.Lock()
+	defer smsc.mu.Unlock()
+
+	for _, session := range smsc.sessions {
+		if session.Held(id) {
+			return session, nil
+		}
+	}
+	return nil, smpp.ErrNotHeld
+}
+
+// forward delivers the message submitted by an ESME to the ESME owning the destination number
+// and sends the DLRs according to its deliver_sm_resp.
+func (smsc *SMSC) forward(from *smpp.Session, owner string, m smpp.Submitted) {
+	err := func() error {
+		to := smsc.Session(owner)
+		if to == nil {
+			return errors.Errorf("session %s not bound", owner)
+		}
+		if to.Transmitter() {
+			return errors.Errorf("session %s is bound as transmitter", owner)
+		}
+
+		return to.Forward(m)
+	}()
+	if err != nil {
+		smsc.lsmpp.WithError(err).Errorf("Could not route message %s to %s", m.ID, owner)
+	} else {
+		smsc.lsmpp.Infof("Message %s routed to %s", m.ID, owner)
+	}
+
+	from.Receipt(m, err)
+}
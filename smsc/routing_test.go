@@ -0,0 +1,316 @@
+package smsc_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/logger"
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smsc3/client"
+	"github.com/mdouchement/smsc3/handset"
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/mdouchement/smsc3/smsc"
+	"github.com/mdouchement/smsc3/smsctest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoute(t *testing.T) {
+	s := &smsc.SMSC{
+		Routes: []*smsc.Route{
+			{Prefix: "+3370", SystemID: "service-a"},
+			{Prefix: "33700000001", SystemID: "service-b"},
+			{Prefix: "+44", SystemID: "service-c"},
+		},
+	}
+
+	route, ok := s.Route("+33700000002")
+	assert.True(t, ok)
+	assert.Equal(t, "service-a", route.SystemID)
+
+	route, ok = s.Route("33700000001")
+	assert.True(t, ok)
+	assert.Equal(t, "service-b", route.SystemID) // Longest prefix
+
+	route, ok = s.Route("+447700900000")
+	assert.True(t, ok)
+	assert.Equal(t, "service-c", route.SystemID)
+
+	_, ok = s.Route("+33600000001")
+	assert.False(t, ok)
+
+	_, err := s.Recipient("", "+33600000001")
+	assert.EqualError(t, err, "no route to +33600000001")
+}
+
+func TestRoute_Pattern(t *testing.T) {
+	route := &smsc.Route{Prefix: "+33", Pattern: `^\+?33[67]\d{8}$`, SystemID: "mobile"}
+	assert.NoError(t, route.Compile())
+
+	assert.True(t, route.Match("+33600000001"))
+	assert.True(t, route.Match("33700000001"))
+	assert.False(t, route.Match("+33100000001"))
+	assert.False(t, route.Match("+44600000001"))
+
+	assert.Error(t, (&smsc.Route{Pattern: "(", SystemID: "invalid"}).Compile())
+}
+
+func TestRecipient_AddressRange(t *testing.T) {
+	l := logger.WrapLogrus(logrus.New())
+	s := smsc.Initialize(l, &smsc.SMSC{
+		Routes: []*smsc.Route{{Prefix: "+44", SystemID: "uk"}},
+	})
+
+	session := func(name, addressRange string) *smpp.Session {
+		c, _ := net.Pipe()
+		session := smpp.NewSession(l, smpp.NewConnection(l, c), &smpp.Account{SystemID: name})
+		assert.NoError(t, session.SetAddressRange(addressRange))
+		s.Register(name, session)
+		return session
+	}
+	fr := session("fr", `^\+?336`)
+	session("uk", "")
+
+	recipient, err := s.Recipient("", "+33600000001")
+	assert.NoError(t, err)
+	assert.Equal(t, fr, recipient)
+
+	recipient, err = s.Recipient("", "33600000001")
+	assert.NoError(t, err)
+	assert.Equal(t, fr, recipient)
+
+	_, err = s.Recipient("fr", "+33700000001")
+	assert.EqualError(t, err, "+33700000001 does not match the address_range of fr")
+
+	_, err = s.Recipient("", "+33700000001")
+	assert.EqualError(t, err, "no route to +33700000001")
+
+	_, err = s.Recipient("", "+447700900000") // Routes win, the session has no address_range
+	assert.NoError(t, err)
+
+	assert.Error(t, fr.SetAddressRange("("))
+}
+
+func TestForward(t *testing.T) {
+	server := smsctest.NewServer(&smsc.SMSC{
+		Routes: []*smsc.Route{{Prefix: "+3370", SystemID: "b"}},
+	})
+	defer server.Close()
+
+	received := make(chan client.Message, 4)
+	connect := func(name string, config client.Config) *client.Client {
+		config.Addr, config.SystemID, config.Password = server.Addr, name, server.Password
+		c, err := client.Dial(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+
+		_, err = server.WaitSession(name, time.Second)
+		require.NoError(t, err)
+		return c
+	}
+	a := connect("a", client.Config{})
+	connect("b", client.Config{
+		OnMessage: func(m client.Message) pdu.Status {
+			received <- m
+			return 0
+		},
+	})
+
+	next := func() pdu.Body {
+		select {
+		case m := <-received:
+			return m.PDU
+		case <-time.After(3 * time.Second):
+			t.Fatal("message not forwarded")
+		}
+		return nil
+	}
+
+	// Port-addressed binary message
+	_, err := a.Send(&smpp.Message{
+		Src:  "+33600000001",
+		Dst:  "+33700000001",
+		Text: pdutext.Binary{0xCA, 0xFE},
+		UDH:  pdutext.UDH{IEs: []pdutext.IE{pdutext.ApplicationPort{Destination: 2948, Source: 9200}}},
+	})
+	require.NoError(t, err)
+	submitted, err := server.NextSubmitSM(time.Second, nil)
+	require.NoError(t, err)
+
+	p := next()
+	f := p.Fields()
+	assert.Equal(t, submitted.PDU.Fields()[pdufield.ShortMessage].Bytes(), f[pdufield.ShortMessage].Bytes())
+	assert.Equal(t, []byte{0x04}, f[pdufield.DataCoding].Bytes())
+	assert.Equal(t, uint8(smpp.UDHI), f[pdufield.ESMClass].Bytes()[0])
+
+	// Multipart message, the segments are forwarded with their UDH
+	text, _, _ := pdutext.SelectCodec(strings.Repeat("long message ", 20))
+	_, err = a.Send(&smpp.Message{Src: "+33600000001", Dst: "+33700000001", Text: text})
+	require.NoError(t, err)
+
+	var submits [][]byte
+	for i := 0; i < 2; i++ {
+		submitted, err := server.NextSubmitSM(time.Second, nil)
+		require.NoError(t, err)
+		submits = append(submits, submitted.PDU.Fields()[pdufield.ShortMessage].Bytes())
+	}
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, submits[i], next().Fields()[pdufield.ShortMessage].Bytes())
+	}
+}
+
+func TestForward_Submitter(t *testing.T) {
+	server := smsctest.NewServer(&smsc.SMSC{
+		Routes: []*smsc.Route{{Prefix: "+3360", SystemID: "a"}},
+	})
+	defer server.Close()
+
+	received := make(chan client.Message, 2)
+	connect := func(name string, config client.Config) *client.Client {
+		config.Addr, config.SystemID, config.Password = server.Addr, name, server.Password
+		c, err := client.Dial(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+
+		_, err = server.WaitSession(name, time.Second)
+		require.NoError(t, err)
+		return c
+	}
+	a := connect("a", client.Config{
+		OnMessage: func(m client.Message) pdu.Status {
+			received <- m
+			return 0
+		},
+	})
+	connect("b", client.Config{
+		AddressRange: `^\+?3370`,
+		OnMessage: func(m client.Message) pdu.Status {
+			received <- m
+			return 0
+		},
+	})
+
+	// Routed to the submitter itself, and owned by b through its address_range only
+	for _, dst := range []string{"+33600000001", "+33700000001"} {
+		_, err := a.Send(&smpp.Message{Src: "+33100000001", Dst: dst, Text: pdutext.GSM7("hello")})
+		require.NoError(t, err)
+		_, err = server.NextSubmitSM(time.Second, nil)
+		require.NoError(t, err)
+
+		r, err := http.Get(server.URL + "/inbox?msisdn=" + url.QueryEscape(dst))
+		require.NoError(t, err)
+		var inbox struct {
+			Inbox handset.Mailbox `json:"inbox"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&inbox))
+		r.Body.Close()
+		assert.Len(t, inbox.Inbox.Messages, 1, dst)
+	}
+
+	select {
+	case m := <-received:
+		t.Fatalf("message to %s forwarded", m.Dst)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+type silent struct{}
+
+func (silent) SubmitSM(*smpp.Session, pdu.Body) (pdu.Status, bool) { return 0, false }
+func (silent) DeliverSMResp(*smpp.Session, pdu.Body)               {}
+
+func TestForward_NoDLR(t *testing.T) {
+	server := smsctest.NewServer(&smsc.SMSC{
+		Routes: []*smsc.Route{{Prefix: "+3370", SystemID: "b"}},
+	})
+	defer server.Close()
+
+	received := make(chan client.Message, 1)
+	receipts := make(chan client.Receipt, 1)
+	connect := func(name string, config client.Config) (*client.Client, *smpp.Session) {
+		config.Addr, config.SystemID, config.Password = server.Addr, name, server.Password
+		c, err := client.Dial(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+
+		session, err := server.WaitSession(name, time.Second)
+		require.NoError(t, err)
+		return c, session
+	}
+	a, session := connect("a", client.Config{
+		OnReceipt: func(r client.Receipt) pdu.Status {
+			receipts <- r
+			return 0
+		},
+	})
+	connect("b", client.Config{
+		OnMessage: func(m client.Message) pdu.Status {
+			received <- m
+			return 0
+		},
+	})
+	session.SetHook(silent{}) // Suppresses the DLRs, like a script returning dlr = false
+
+	_, err := a.Send(&smpp.Message{
+		Src:      "+33600000001",
+		Dst:      "+33700000001",
+		Text:     pdutext.GSM7("hello"),
+		Register: pdufield.FinalDeliveryReceipt,
+	})
+	require.NoError(t, err)
+
+	select {
+	case <-received:
+	case <-time.After(3 * time.Second):
+		t.Fatal("message not forwarded")
+	}
+
+	select {
+	case r := <-receipts:
+		t.Fatalf("unexpected DLR %s", r.Stat)
+	case <-time.After(1500 * time.Millisecond): // The DLRs are sent after one second
+	}
+}
+
+func TestRecipient_Transmitter(t *testing.T) {
+	server := smsctest.NewServer(&smsc.SMSC{
+		Routes: []*smsc.Route{{Prefix: "+3370", SystemID: "tx"}},
+	})
+	defer server.Close()
+
+	for _, config := range []client.Config{
+		{SystemID: "tx", BindType: client.Transmitter, AddressRange: `^\+?336`},
+		{SystemID: "rx", BindType: client.Receiver, AddressRange: `^\+?3361`},
+	} {
+		config.Addr, config.Password = server.Addr, server.Password
+		c, err := client.Dial(config)
+		require.NoError(t, err)
+		defer c.Close()
+
+		_, err = server.WaitSession(config.SystemID, time.Second)
+		require.NoError(t, err)
+	}
+
+	tx := server.SMSC.Session("tx")
+	assert.True(t, tx.Transmitter())
+	assert.False(t, tx.HasAddressRange()) // Ignored
+
+	_, err := server.SMSC.Recipient("", "+33600000001")
+	assert.EqualError(t, err, "no route to +33600000001")
+	_, err = server.SMSC.Recipient("tx", "+33600000001")
+	assert.EqualError(t, err, "session tx is bound as transmitter")
+	_, err = server.SMSC.Recipient("", "+33700000001") // Routed
+	assert.EqualError(t, err, "session tx is bound as transmitter")
+
+	recipient, err := server.SMSC.Recipient("", "+33610000001")
+	assert.NoError(t, err)
+	assert.Equal(t, server.SMSC.Session("rx"), recipient)
+}
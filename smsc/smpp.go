@@ -3,10 +3,13 @@ package smsc
 import (
 	"io"
 	"net"
+	"time"
 
 	"github.com/mdouchement/smpp/smpp/pdu"
 	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
 	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
+	"github.com/mdouchement/smsc3/handset"
+	"github.com/mdouchement/smsc3/pdutext"
 	"github.com/mdouchement/smsc3/smpp"
 	"github.com/pkg/errors"
 )
@@ -22,8 +25,16 @@ func (smsc *SMSC) smpp() error {
 	}
 	smsc.lsmpp.Infof("Listening SMPP %s", smsc.SMPPaddr)
 
+	return smsc.ServeSMPP(l)
+}
+
+// ServeSMPP accepts the SMPP connections on the given listener until it is closed.
+func (smsc *SMSC) ServeSMPP(l net.Listener) error {
 	for {
 		c, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
 		if err != nil {
 			smsc.lsmpp.Error(errors.Wrap(err, "smpp: accept"))
 			continue
@@ -46,19 +57,40 @@ func (smsc *SMSC) smpp() error {
 
 			// Session connection
 			var r pdu.Body
-			sname, r, err := smsc.auth(p)
+			account, r, err := smsc.auth(p)
 			if err != nil {
 				smsc.lsmpp.Error(errors.Wrap(err, "smpp: authentication"))
 				return
 			}
 
+			if smsc.script != nil {
+				r.Header().Status = smsc.script.Bind(p)
+			}
+
 			if err = sc.Serialize(r); err != nil {
 				smsc.lsmpp.Error(errors.Wrap(err, "smpp: authentication"))
 				return
 			}
+			if r.Header().Status != 0 {
+				smsc.lsmpp.Errorf("smpp: bind of %s rejected by the script: %s", account.SystemID, r.Header().Status.Error())
+				return
+			}
 
-			session := smpp.NewSession(smsc.lsmpp, sc, sname)
+			sname := account.SystemID
+			session := smpp.NewSession(smsc.lsmpp, sc, account)
 			defer session.Close()
+			// A transmitter receives no message (MO), its address_range is meaningless.
+			session.SetTransmitter(p.Header().ID == pdu.BindTransmitterID)
+			if v := p.Fields()[pdufield.AddressRange]; v != nil && !session.Transmitter() {
+				if err = session.SetAddressRange(v.String()); err != nil {
+					smsc.lsmpp.WithError(err).Warnf("Ignoring the address_range of %s", sname)
+				}
+			}
+			session.SetHandler(smsc.mux)
+			session.OnSubmit(smsc.deliver(session))
+			if smsc.script != nil {
+				session.SetHook(smsc.script)
+			}
 
 			smsc.Register(sname, session)
 			defer smsc.Unregister(sname)
@@ -74,7 +106,7 @@ func (smsc *SMSC) smpp() error {
 	}
 }
 
-func (smsc *SMSC) auth(p pdu.Body) (string, pdu.Body, error) {
+func (smsc *SMSC) auth(p pdu.Body) (*smpp.Account, pdu.Body, error) {
 	var r pdu.Body
 	switch p.Header().ID {
 	case pdu.BindTransmitterID:
@@ -84,7 +116,7 @@ func (smsc *SMSC) auth(p pdu.Body) (string, pdu.Body, error) {
 	case pdu.BindTransceiverID:
 		r = pdu.NewBindTransceiverRespSeq(p.Header().Seq)
 	default:
-		return "", r, errors.New("unexpected pdu, want bind")
+		return nil, r, errors.New("unexpected pdu, want bind")
 	}
 
 	f := p.Fields()
@@ -92,19 +124,72 @@ func (smsc *SMSC) auth(p pdu.Body) (string, pdu.Body, error) {
 	password := f[pdufield.Password]
 
 	if user == nil || password == nil {
-		return "", r, errors.New("malformed pdu, missing system_id/password")
+		return nil, r, errors.New("malformed pdu, missing system_id/password")
 	}
 
-	session := user.String()
-	if smsc.Username != "" && user.String() != smsc.Username {
-		return session, r, errors.New("invalid user")
+	account := smsc.Account(user.String())
+	if _, ok := smsc.accounts[account.SystemID]; !ok && smsc.Username != "" && user.String() != smsc.Username {
+		return account, r, errors.New("invalid user")
 	}
 
-	if smsc.Password != "" && password.String() != smsc.Password {
-		return session, r, errors.New("invalid passwd")
+	if account.Password != "" && password.String() != account.Password {
+		return account, r, errors.New("invalid passwd")
 	}
 
 	r.Fields().Set(pdufield.SystemID, smsc.SystemID)
 	r.TLVFields().Set(pdutlv.TagScInterfaceVersion, 0x34) // SMPP34
-	return session, r, nil
+	return account, r, nil
+}
+
+// deliver delivers the short message submitted by an ESME to the ESME owning the destination number according to the routes, if any,
+// or to the inbox of the simulated handset. A virtual handset answers to the session.
+// A message is never routed back to the session that submitted it.
+func (smsc *SMSC) deliver(session *smpp.Session) func(smpp.Submitted) bool {
+	return func(m smpp.Submitted) bool {
+		if owner, ok := smsc.Owner(m.Dst); ok && owner != session.Account().SystemID {
+			go smsc.forward(session, owner, m)
+			return true
+		}
+
+		var class string
+		if c := pdutext.Class(m.Coding); c != pdutext.ClassNone {
+			class = c.String()
+		}
+
+		h, ok := smsc.Handset(m.Dst)
+		result := smsc.inbox.Deliver(handset.Message{
+			ID:         m.ID,
+			From:       m.Src,
+			To:         m.Dst,
+			Text:       m.Text,
+			ProtocolID: m.ProtocolID,
+			Class:      class,
+			AfterStop:  ok && h.Stopped(m.Src),
+		})
+		smsc.lsmpp.Infof("Message %s %s in the inbox of %s", m.ID, result, m.Dst)
+
+		if ok && result != handset.Discarded {
+			if reply, ok := h.Answer(m.Src, m.Text); ok {
+				go smsc.reply(session, h, m, reply)
+			}
+		}
+		return false
+	}
+}
+
+// reply sends the reply of a virtual handset to the session that submitted the message.
+func (smsc *SMSC) reply(session *smpp.Session, h *handset.Handset, m smpp.Submitted, reply handset.Reply) {
+	time.Sleep(reply.Delay)
+
+	c, _, _ := pdutext.SelectCodec(reply.Text)
+	err := session.Send(&smpp.Message{
+		Src:  h.MSISDN,
+		Dst:  m.Src,
+		Text: c,
+	}, pdu.NewDeliverSM())
+	if err != nil {
+		smsc.lsmpp.WithError(err).Errorf("Could not reply to message %s", m.ID)
+		return
+	}
+	smsc.lsmpp.Infof("Handset %s replied to message %s: %s", h.MSISDN, m.ID, reply.Text)
 }
@@ -4,6 +4,9 @@ import (
 	"sync"
 
 	"github.com/mdouchement/logger"
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smsc3/handset"
+	"github.com/mdouchement/smsc3/script"
 	"github.com/mdouchement/smsc3/smpp"
 )
 
@@ -19,7 +22,15 @@ type SMSC struct {
 	SystemID string
 	Username string
 	Password string
+	Accounts []*smpp.Account
+	Routes   []*Route           // Numbers owned by the ESMEs, the messages submitted to them are delivered to these ESMEs
+	Handsets []*handset.Handset // Virtual handsets answering automatically the messages submitted to them
+	Script   string             // Lua script hooked on the PDUs, see the script package
+	script   *script.Engine
+	accounts map[string]*smpp.Account
 	sessions map[string]*smpp.Session
+	mux      *smpp.ServeMux // Handlers of the PDUs sent by the ESMEs
+	inbox    *handset.Inbox // Messages submitted by the ESMEs, as received by the simulated handsets
 
 	// HTTP
 	HTTPaddr string
@@ -31,6 +42,44 @@ func Initialize(l logger.Logger, smsc *SMSC) *SMSC {
 	smsc.lhttp = l.WithPrefix("[HTTP]")
 	smsc.lsmpp = l.WithPrefix("[SMPP]")
 	smsc.sessions = make(map[string]*smpp.Session, 1)
+	smsc.mux = smpp.NewServeMux()
+	smsc.inbox = handset.NewInbox()
+
+	smsc.accounts = make(map[string]*smpp.Account, len(smsc.Accounts))
+	for _, account := range smsc.Accounts {
+		if err := account.Compile(); err != nil {
+			smsc.log.WithError(err).Errorf("Ignoring the invalid DLR outcome rules of %s", account.SystemID)
+		}
+		smsc.accounts[account.SystemID] = account
+	}
+
+	routes := smsc.Routes[:0]
+	for _, route := range smsc.Routes {
+		if err := route.Compile(); err != nil {
+			smsc.log.WithError(err).Error("Ignoring invalid route")
+			continue
+		}
+		routes = append(routes, route)
+	}
+	smsc.Routes = routes
+
+	handsets := smsc.Handsets[:0]
+	for _, h := range smsc.Handsets {
+		if err := h.Compile(); err != nil {
+			smsc.log.WithError(err).Error("Ignoring invalid handset")
+			continue
+		}
+		handsets = append(handsets, h)
+	}
+	smsc.Handsets = handsets
+
+	if smsc.Script != "" {
+		var err error
+		smsc.script, err = script.New(l.WithPrefix("[SCRIPT]"), smsc.Script, smsc.Session)
+		if err != nil {
+			smsc.log.WithError(err).Error("Could not load the script, fix it and reload it")
+		}
+	}
 
 	if smsc.SystemID == "" {
 		smsc.SystemID = "smsc3"
@@ -53,6 +102,44 @@ func (smsc *SMSC) Listen() error {
 	return <-err
 }
 
+// Account returns the account of the given system_id.
+// When the system_id has no dedicated account, an account using the default settings is returned.
+func (smsc *SMSC) Account(systemID string) *smpp.Account {
+	if account, ok := smsc.accounts[systemID]; ok {
+		return account
+	}
+
+	return &smpp.Account{
+		SystemID: systemID,
+		Password: smsc.Password,
+	}
+}
+
+// Handle registers the handler of the given command ID for all the sessions, replacing the default one (e.g. smpp.SubmitSMHandler).
+func (smsc *SMSC) Handle(id pdu.ID, h smpp.Handler) {
+	smsc.mux.Handle(id, h)
+}
+
+// HandleFunc registers the handler function of the given command ID for all the sessions.
+func (smsc *SMSC) HandleFunc(id pdu.ID, f func(s *smpp.Session, p pdu.Body) pdu.Body) {
+	smsc.mux.HandleFunc(id, f)
+}
+
+// Use appends middlewares wrapping the handlers of all the sessions.
+func (smsc *SMSC) Use(middlewares ...smpp.Middleware) {
+	smsc.mux.Use(middlewares...)
+}
+
+// Handset returns the virtual handset of the given number.
+func (smsc *SMSC) Handset(msisdn string) (*handset.Handset, bool) {
+	for _, h := range smsc.Handsets {
+		if h.Is(msisdn) {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
 // Register registers a session.
 func (smsc *SMSC) Register(name string, s *smpp.Session) {
 	smsc.mu.Lock()
@@ -81,12 +168,22 @@ func (smsc *SMSC) Unregister(name string) {
 func (smsc *SMSC) Stop() {
 	smsc.log.Info("Gracefully stopping...")
 
-	// smsc.mu.Lock()
-	// defer smsc.mu.Unlock()
-
+	smsc.mu.Lock()
+	sessions := make(map[string]*smpp.Session, len(smsc.sessions))
 	for name, session := range smsc.sessions {
+		sessions[name] = session
+	}
+	smsc.mu.Unlock()
+
+	for name, session := range sessions {
 		if err := session.Close(); err != nil {
 			smsc.log.WithError(err).Errorf("Could not close the session %s", name)
 		}
 	}
+
+	if smsc.script != nil {
+		smsc.script.Close()
+	}
+
+	smsc.inbox.Close()
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"os"
 	"os/signal"
 	"regexp"
@@ -28,6 +29,25 @@ func main() {
 		Username: os.Getenv("SMSC3_USERNAME"),
 		Password: os.Getenv("SMSC3_PASSWORD"),
 		HTTPaddr: os.Getenv("SMSC3_HTTP_ADDR"),
+		Script:   os.Getenv("SMSC3_SCRIPT"),
+	}
+
+	if filename := os.Getenv("SMSC3_ACCOUNTS"); filename != "" {
+		if err := load(filename, &s.Accounts); err != nil {
+			l.Fatal(err)
+		}
+	}
+
+	if filename := os.Getenv("SMSC3_ROUTES"); filename != "" {
+		if err := load(filename, &s.Routes); err != nil {
+			l.Fatal(err)
+		}
+	}
+
+	if filename := os.Getenv("SMSC3_HANDSETS"); filename != "" {
+		if err := load(filename, &s.Handsets); err != nil {
+			l.Fatal(err)
+		}
 	}
 
 	if s.SMPPaddr == "" {
@@ -50,3 +70,13 @@ func main() {
 	signal.Notify(signals, os.Interrupt, os.Kill)
 	<-signals
 }
+
+func load(filename string, v any) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewDecoder(f).Decode(v)
+}
@@ -0,0 +1,270 @@
+// Package smsctest provides an SMSC running in-process for end-to-end tests, like net/http/httptest.
+package smsctest
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/mdouchement/logger"
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smpp/smpp/pdu/pdutlv"
+	"github.com/mdouchement/smsc3/dlr"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/mdouchement/smsc3/smsc"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type (
+	// A Server is an SMSC listening on random local ports.
+	Server struct {
+		SMSC     *smsc.SMSC
+		Addr     string // SMPP address, host:port
+		URL      string // Base URL of the HTTP API, http://host:port
+		Password string // Password of the ESMEs, any system_id is accepted by default
+
+		listener net.Listener
+		http     *httptest.Server
+
+		mu       sync.Mutex
+		changed  chan struct{}
+		submits  []*SubmitSM
+		sessions map[*smpp.Session]bool // Sessions whose DLRs are recorded
+		dlrs     map[receipt]uint32     // Sequence of the DLR of a message_id
+		acks     map[sequence]pdu.Status
+	}
+
+	// A SubmitSM is a submit_sm received by the Server.
+	SubmitSM struct {
+		SystemID string
+		PDU      pdu.Body
+		Response pdu.Body // submit_sm_resp
+		Text     string   // Decoded text of the segment
+
+		returned bool
+	}
+
+	sequence struct {
+		session *smpp.Session
+		seq     uint32
+	}
+
+	receipt struct {
+		session *smpp.Session
+		id      string
+	}
+)
+
+// NewServer starts and returns a new Server using the given configuration, the default one when nil.
+// The addresses of the configuration are ignored. The caller should call Close when finished.
+func NewServer(config *smsc.SMSC) *Server {
+	if config == nil {
+		config = &smsc.SMSC{}
+	}
+	if config.Password == "" {
+		config.Password = "password"
+	}
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	smsc.Initialize(logger.WrapLogrus(l), config)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("smsctest: failed to listen on a port: %v", err))
+	}
+	config.SMPPaddr = listener.Addr().String()
+
+	s := &Server{
+		SMSC:     config,
+		Addr:     config.SMPPaddr,
+		Password: config.Password,
+		listener: listener,
+		changed:  make(chan struct{}),
+		sessions: map[*smpp.Session]bool{},
+		dlrs:     map[receipt]uint32{},
+		acks:     map[sequence]pdu.Status{},
+	}
+	config.Use(s.record)
+
+	s.http = httptest.NewServer(config.HTTPHandler())
+	s.URL = s.http.URL
+	config.HTTPaddr = s.http.Listener.Addr().String()
+
+	go config.ServeSMPP(listener)
+	return s
+}
+
+// Close stops the Server and closes the sessions.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.http.Close()
+	s.SMSC.Stop()
+}
+
+// WaitSession waits for an ESME to bind with the given system_id and returns its session.
+func (s *Server) WaitSession(systemID string, timeout time.Duration) (*smpp.Session, error) {
+	var session *smpp.Session
+	ok := s.wait(timeout, func() bool {
+		session = s.SMSC.Session(systemID)
+		return session != nil
+	})
+	if !ok {
+		return nil, errors.Errorf("smsctest: no session %s", systemID)
+	}
+	return session, nil
+}
+
+// NextSubmitSM waits for the next submit_sm matching the given predicate (all the submit_sm when nil), in reception order.
+// A submit_sm is returned only once.
+func (s *Server) NextSubmitSM(timeout time.Duration, match func(*SubmitSM) bool) (*SubmitSM, error) {
+	var found *SubmitSM
+	ok := s.wait(timeout, func() bool {
+		for _, submit := range s.submits {
+			if !submit.returned && (match == nil || match(submit)) {
+				submit.returned = true
+				found = submit
+				return true
+			}
+		}
+		return false
+	})
+	if !ok {
+		return nil, errors.New("smsctest: no matching submit_sm")
+	}
+	return found, nil
+}
+
+// WaitDLRAck waits for the DLR of the given message_id to be acknowledged by the ESME
+// and returns the command_status of its deliver_sm_resp.
+func (s *Server) WaitDLRAck(messageID string, timeout time.Duration) (pdu.Status, error) {
+	var status pdu.Status
+	ok := s.wait(timeout, func() bool {
+		for r, seq := range s.dlrs {
+			if r.id != messageID {
+				continue
+			}
+
+			var acked bool
+			if status, acked = s.acks[sequence{session: r.session, seq: seq}]; acked {
+				return true
+			}
+		}
+		return false
+	})
+	if !ok {
+		return 0, errors.Errorf("smsctest: DLR of %s not acknowledged", messageID)
+	}
+	return status, nil
+}
+
+// Deliver sends the given message (MO) to the session of the given system_id, routed by destination number when empty,
+// and waits for its deliver_sm_resp. A rejected message returns its pdu.Status.
+func (s *Server) Deliver(systemID string, m *smpp.Message) error {
+	session, err := s.SMSC.Recipient(systemID, m.Dst)
+	if err != nil {
+		return err
+	}
+	return session.Send(m, pdu.NewDeliverSM())
+}
+
+// record is the middleware recording the PDUs sent by the ESMEs.
+func (s *Server) record(next smpp.Handler) smpp.Handler {
+	return smpp.HandlerFunc(func(session *smpp.Session, p pdu.Body) pdu.Body {
+		s.watch(session)
+		r := next.ServeSMPP(session, p)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		switch p.Header().ID {
+		case pdu.SubmitSMID:
+			submit := &SubmitSM{
+				SystemID: session.Account().SystemID,
+				PDU:      p,
+				Response: r,
+			}
+			submit.Text, _ = smpp.Text(p, session.Account().Alphabet())
+			s.submits = append(s.submits, submit)
+			s.notify()
+		case pdu.DeliverSMRespID:
+			s.acks[sequence{session: session, seq: p.Header().Seq}] = p.Header().Status
+			s.notify()
+		}
+
+		return r
+	})
+}
+
+// watch records the DLRs sent to the given session, from its first PDU.
+// The DLRs always follow a submit_sm of the session.
+func (s *Server) watch(session *smpp.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sessions[session] {
+		return
+	}
+	s.sessions[session] = true
+
+	session.OnDLR(func(d pdu.Body) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		var id string
+		if v := d.TLVFields()[pdutlv.TagReceiptedMessageID]; v != nil {
+			id = v.String()
+		} else if text, err := smpp.Text(d, session.Account().Alphabet()); err == nil {
+			if parsed, err := dlr.Parse(text); err == nil {
+				id = parsed.ID
+			}
+		}
+		s.dlrs[receipt{session: session, id: id}] = d.Header().Seq
+		s.notify()
+	})
+}
+
+// MessageID returns the message_id of the submit_sm_resp.
+func (m *SubmitSM) MessageID() string {
+	if m.Response == nil {
+		return ""
+	}
+
+	if v := m.Response.Fields()[pdufield.MessageID]; v != nil {
+		return v.String()
+	}
+	return ""
+}
+
+// notify wakes up the waiters, the lock must be held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// wait calls fn with the lock held until it returns true or the timeout expires.
+func (s *Server) wait(timeout time.Duration, fn func() bool) bool {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		ok := fn()
+		changed := s.changed
+		s.mu.Unlock()
+
+		if ok {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-time.After(10 * time.Millisecond): // The sessions are not notified
+		case <-deadline:
+			return false
+		}
+	}
+}
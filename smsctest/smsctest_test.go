@@ -0,0 +1,143 @@
+package smsctest_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/smpp/smpp/pdu"
+	"github.com/mdouchement/smpp/smpp/pdu/pdufield"
+	"github.com/mdouchement/smsc3/pdutext"
+	"github.com/mdouchement/smsc3/smpp"
+	"github.com/mdouchement/smsc3/smsctest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// esme binds a raw ESME answering the deliver_sm with the given status.
+func esme(t *testing.T, server *smsctest.Server, systemID string, status pdu.Status) (net.Conn, <-chan pdu.Body) {
+	conn, err := net.Dial("tcp", server.Addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	bind := pdu.NewBindTransceiver()
+	bind.Fields().Set(pdufield.SystemID, systemID)
+	bind.Fields().Set(pdufield.Password, server.Password)
+	require.NoError(t, bind.SerializeTo(conn))
+	r, err := pdu.Decode(conn)
+	require.NoError(t, err)
+	require.Equal(t, pdu.Status(0), r.Header().Status)
+
+	received := make(chan pdu.Body, 16)
+	go func() {
+		for {
+			p, err := pdu.Decode(conn)
+			if err != nil {
+				close(received)
+				return
+			}
+			switch p.Header().ID {
+			case pdu.DeliverSMID:
+				resp := pdu.NewDeliverSMRespSeq(p.Header().Seq)
+				resp.Header().Status = status
+				resp.SerializeTo(conn)
+			case pdu.UnbindID:
+				pdu.NewUnbindRespSeq(p.Header().Seq).SerializeTo(conn)
+			}
+			received <- p
+		}
+	}()
+
+	_, err = server.WaitSession(systemID, time.Second)
+	require.NoError(t, err)
+	return conn, received
+}
+
+func TestServer(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+	other := smsctest.NewServer(nil) // Several instances run in the same process
+	defer other.Close()
+	assert.NotEqual(t, server.Addr, other.Addr)
+
+	conn, received := esme(t, server, "esme", 0)
+
+	for _, text := range []string{"hello", "world"} {
+		submit := pdu.NewSubmitSM(nil)
+		submit.Fields().Set(pdufield.SourceAddr, "GOPHER")
+		submit.Fields().Set(pdufield.DestinationAddr, "33600000001")
+		submit.Fields().Set(pdufield.RegisteredDelivery, 1)
+		submit.Fields().Set(pdufield.ShortMessage, pdutext.GSM7(text))
+		require.NoError(t, submit.SerializeTo(conn))
+	}
+
+	m, err := server.NextSubmitSM(time.Second, func(m *smsctest.SubmitSM) bool {
+		return m.Text == "world"
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "esme", m.SystemID)
+	assert.NotEmpty(t, m.MessageID())
+
+	m, err = server.NextSubmitSM(time.Second, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", m.Text) // The first not yet returned
+
+	_, err = server.NextSubmitSM(100*time.Millisecond, nil)
+	assert.Error(t, err)
+
+	status, err := server.WaitDLRAck(m.MessageID(), 3*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, pdu.Status(0), status)
+
+	_, err = other.NextSubmitSM(100*time.Millisecond, nil)
+	assert.Error(t, err)
+
+	c, _, _ := pdutext.SelectCodec("Hello ESME")
+	err = server.Deliver("esme", &smpp.Message{Src: "+33600000001", Dst: "GOPHER", Text: c})
+	assert.NoError(t, err)
+
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case p := <-received:
+			if p.Header().ID != pdu.DeliverSMID || !strings.Contains(p.Fields()[pdufield.ShortMessage].String(), "Hello ESME") {
+				continue
+			}
+			return
+		case <-timeout:
+			t.Fatal("MO not received")
+		}
+	}
+}
+
+func TestServer_Rejected(t *testing.T) {
+	server := smsctest.NewServer(nil)
+	defer server.Close()
+
+	_, received := esme(t, server, "esme", 0x45)
+
+	c, _, _ := pdutext.SelectCodec("Hello ESME")
+	err := server.Deliver("esme", &smpp.Message{Src: "+33600000001", Dst: "GOPHER", Text: c})
+	var status pdu.Status
+	assert.True(t, errors.As(err, &status))
+	assert.Equal(t, pdu.Status(0x45), status)
+
+	// The rejected MO was received once by the ESME and is not retried.
+	var mo []pdu.Body
+	timeout := time.After(200 * time.Millisecond)
+	for done := false; !done; {
+		select {
+		case p := <-received:
+			if p.Header().ID == pdu.DeliverSMID {
+				mo = append(mo, p)
+			}
+		case <-timeout:
+			done = true
+		}
+	}
+	require.Len(t, mo, 1)
+	assert.Contains(t, mo[0].Fields()[pdufield.ShortMessage].String(), "Hello ESME")
+	assert.Equal(t, "+33600000001", mo[0].Fields()[pdufield.SourceAddr].String())
+}
@@ -0,0 +1,252 @@
+// Package wap builds WAP Push messages: a WSP push PDU carrying a WBXML encoded
+// Service Indication or Service Loading (WAP-167 and WAP-168).
+package wap
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// PortPush is the WDP destination port of the WAP Push connectionless session service.
+	PortPush = 2948
+	// PortWSP is the WDP source port of the connectionless WSP.
+	PortWSP = 9200
+)
+
+// WSP well-known content types (WAP-230 Appendix A).
+const (
+	ContentTypeSI = 0x2E // application/vnd.wap.sic
+	ContentTypeSL = 0x30 // application/vnd.wap.slc
+)
+
+const (
+	wbxmlVersion = 0x02 // WBXML 1.2
+	publicIDSI   = 0x05 // -//WAPFORUM//DTD SI 1.0//EN
+	publicIDSL   = 0x06 // -//WAPFORUM//DTD SL 1.0//EN
+	charsetUTF8  = 0x6A
+
+	tokenEnd    = 0x01
+	tokenString = 0x03 // STR_I, inline string
+	tokenOpaque = 0xC3
+
+	withContent    = 0x40
+	withAttributes = 0x80
+
+	pduPush = 0x06
+	tid     = 0x01
+)
+
+type (
+	// A ServiceIndication notifies the user about a URL with a text (SI).
+	ServiceIndication struct {
+		URL     string
+		Text    string
+		ID      string    // Optional, si-id
+		Action  string    // Optional, signal-none, signal-low, signal-medium (default), signal-high or delete
+		Created time.Time // Optional
+		Expires time.Time // Optional
+	}
+
+	// A ServiceLoading asks the user agent to load a URL (SL).
+	ServiceLoading struct {
+		URL    string
+		Action string // Optional, execute-low (default), execute-high or cache
+	}
+)
+
+// Tokens of the SI and SL attribute start tokens.
+var (
+	siActions = map[string]byte{
+		"signal-none":   0x05,
+		"signal-low":    0x06,
+		"signal-medium": 0x07,
+		"signal-high":   0x08,
+		"delete":        0x09,
+	}
+	siHrefs = []prefix{
+		{"https://www.", 0x0F},
+		{"http://www.", 0x0D},
+		{"https://", 0x0E},
+		{"http://", 0x0C},
+		{"", 0x0B},
+	}
+
+	slActions = map[string]byte{
+		"execute-low":  0x05,
+		"execute-high": 0x06,
+		"cache":        0x07,
+	}
+	slHrefs = []prefix{
+		{"https://www.", 0x0C},
+		{"http://www.", 0x0A},
+		{"https://", 0x0B},
+		{"http://", 0x09},
+		{"", 0x08},
+	}
+)
+
+type prefix struct {
+	value string
+	token byte
+}
+
+// Encode returns the WSP push PDU of the SI.
+func (si ServiceIndication) Encode() ([]byte, error) {
+	body, err := si.WBXML()
+	if err != nil {
+		return nil, err
+	}
+	return Push(ContentTypeSI, body), nil
+}
+
+// WBXML returns the WBXML encoded SI document.
+func (si ServiceIndication) WBXML() ([]byte, error) {
+	if si.URL == "" && si.Action != "delete" {
+		return nil, errors.New("wap: missing SI URL")
+	}
+
+	token, ok := siActions[si.Action]
+	if !ok && si.Action != "" {
+		return nil, errors.Errorf("wap: unsupported SI action: %s", si.Action)
+	}
+
+	p := []byte{wbxmlVersion, publicIDSI, charsetUTF8, 0x00}
+	p = append(p, 0x05|withContent)                // <si>
+	p = append(p, 0x06|withContent|withAttributes) // <indication
+	if si.URL != "" {
+		p = append(p, href(siHrefs, si.URL)...) // href
+	}
+	if ok {
+		p = append(p, token) // action
+	}
+	if si.ID != "" {
+		p = append(p, 0x11)
+		p = append(p, inline(si.ID)...) // si-id
+	}
+	if !si.Created.IsZero() {
+		p = append(p, 0x0A)
+		p = append(p, date(si.Created)...) // created
+	}
+	if !si.Expires.IsZero() {
+		p = append(p, 0x10)
+		p = append(p, date(si.Expires)...) // si-expires
+	}
+	p = append(p, tokenEnd) // >
+	if si.Text != "" {
+		p = append(p, inline(si.Text)...)
+	}
+	p = append(p, tokenEnd) // </indication>
+	p = append(p, tokenEnd) // </si>
+
+	return p, nil
+}
+
+// Encode returns the WSP push PDU of the SL.
+func (sl ServiceLoading) Encode() ([]byte, error) {
+	body, err := sl.WBXML()
+	if err != nil {
+		return nil, err
+	}
+	return Push(ContentTypeSL, body), nil
+}
+
+// WBXML returns the WBXML encoded SL document.
+func (sl ServiceLoading) WBXML() ([]byte, error) {
+	if sl.URL == "" {
+		return nil, errors.New("wap: missing SL URL")
+	}
+
+	token, ok := slActions[sl.Action]
+	if !ok && sl.Action != "" {
+		return nil, errors.Errorf("wap: unsupported SL action: %s", sl.Action)
+	}
+
+	p := []byte{wbxmlVersion, publicIDSL, charsetUTF8, 0x00}
+	p = append(p, 0x05|withAttributes)      // <sl
+	p = append(p, href(slHrefs, sl.URL)...) // href
+	if ok {
+		p = append(p, token) // action
+	}
+	p = append(p, tokenEnd) // />
+
+	return p, nil
+}
+
+// Push returns the connectionless WSP push PDU of the given well-known content type and body.
+func Push(contentType byte, body []byte) []byte {
+	headers := []byte{
+		0x03,                     // Value length
+		contentType | 0x80,       // Well-known media
+		0x81, charsetUTF8 | 0x80, // Charset=utf-8
+	}
+
+	p := []byte{tid, pduPush}
+	p = append(p, uintvar(len(headers))...)
+	p = append(p, headers...)
+	return append(p, body...)
+}
+
+func href(prefixes []prefix, url string) []byte {
+	for _, v := range prefixes {
+		if strings.HasPrefix(url, v.value) {
+			return append([]byte{v.token}, value(url[len(v.value):])...)
+		}
+	}
+	return nil // Unreachable, the last prefix is empty
+}
+
+// value encodes an attribute value with the SI/SL attribute value tokens.
+func value(s string) []byte {
+	var p []byte
+
+	for s != "" {
+		i, token := len(s), byte(0)
+		for t, v := range []string{".com/", ".edu/", ".net/", ".org/"} {
+			if j := strings.Index(s, v); j >= 0 && j < i {
+				i, token = j, byte(0x85+t)
+			}
+		}
+
+		if i > 0 {
+			p = append(p, inline(s[:i])...)
+		}
+		if token == 0 {
+			break
+		}
+		p = append(p, token)
+		s = s[i+5:]
+	}
+
+	return p
+}
+
+func inline(s string) []byte {
+	p := append([]byte{tokenString}, s...)
+	return append(p, 0x00)
+}
+
+// date encodes the date as an opaque of BCD digits YYYYMMDDhhmmss without trailing zeros (WAP-167 §8.2.2).
+func date(t time.Time) []byte {
+	digits := t.UTC().Format("20060102150405")
+
+	var p []byte
+	for i := 0; i < len(digits); i += 2 {
+		p = append(p, (digits[i]-'0')<<4|(digits[i+1]-'0'))
+	}
+	for len(p) > 0 && p[len(p)-1] == 0 {
+		p = p[:len(p)-1]
+	}
+
+	return append([]byte{tokenOpaque, byte(len(p))}, p...)
+}
+
+func uintvar(n int) []byte {
+	p := []byte{byte(n & 0x7F)}
+	for n >>= 7; n > 0; n >>= 7 {
+		p = append([]byte{byte(n&0x7F) | 0x80}, p...)
+	}
+	return p
+}
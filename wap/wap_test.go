@@ -0,0 +1,60 @@
+package wap_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdouchement/smsc3/wap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceIndication(t *testing.T) {
+	// WAP-167 Appendix C
+	si := wap.ServiceIndication{
+		URL:     "http://www.xyz.com/email/123/abc.wml",
+		Text:    "You have 4 new emails",
+		Created: time.Date(1999, 6, 25, 15, 23, 15, 0, time.UTC),
+		Expires: time.Date(1999, 6, 30, 0, 0, 0, 0, time.UTC),
+	}
+
+	p, err := si.WBXML()
+	assert.NoError(t, err)
+
+	expected := []byte{0x02, 0x05, 0x6A, 0x00, 0x45, 0xC6, 0x0D, 0x03}
+	expected = append(expected, "xyz"...)
+	expected = append(expected, 0x00, 0x85, 0x03)
+	expected = append(expected, "email/123/abc.wml"...)
+	expected = append(expected, 0x00, 0x0A, 0xC3, 0x07, 0x19, 0x99, 0x06, 0x25, 0x15, 0x23, 0x15, 0x10, 0xC3, 0x04, 0x19, 0x99, 0x06, 0x30, 0x01, 0x03)
+	expected = append(expected, "You have 4 new emails"...)
+	expected = append(expected, 0x00, 0x01, 0x01)
+	assert.Equal(t, expected, p)
+
+	p, err = si.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x06, 0x04, 0x03, 0xAE, 0x81, 0xEA}, p[:7])
+	assert.Equal(t, expected, p[7:])
+
+	_, err = wap.ServiceIndication{URL: "http://a", Action: "explode"}.WBXML()
+	assert.Error(t, err)
+}
+
+func TestServiceLoading(t *testing.T) {
+	// WAP-168 Appendix C
+	sl := wap.ServiceLoading{
+		URL:    "http://www.xyz.com/ppaid/123/abc.wml",
+		Action: "execute-high",
+	}
+
+	p, err := sl.Encode()
+	assert.NoError(t, err)
+
+	expected := []byte{0x01, 0x06, 0x04, 0x03, 0xB0, 0x81, 0xEA, 0x02, 0x06, 0x6A, 0x00, 0x85, 0x0A, 0x03}
+	expected = append(expected, "xyz"...)
+	expected = append(expected, 0x00, 0x85, 0x03)
+	expected = append(expected, "ppaid/123/abc.wml"...)
+	expected = append(expected, 0x00, 0x06, 0x01)
+	assert.Equal(t, expected, p)
+
+	_, err = wap.ServiceLoading{}.Encode()
+	assert.Error(t, err)
+}